@@ -0,0 +1,83 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+
+	log "github.com/sirupsen/logrus"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const priorityAnnotation string = syncAnnotation + "/priority"
+
+// sourceGetter fetches a source object of one kind by namespace and name
+type sourceGetter func(namespace, name string) (metav1.Object, error)
+
+// sourcePriority returns the value of priority annotation, defaults to 0
+func sourcePriority(o metav1.Object) int {
+	v, ok := o.GetAnnotations()[priorityAnnotation]
+	if !ok {
+		return 0
+	}
+	p, err := strconv.Atoi(v)
+	if err != nil {
+		log.WithFields(log.Fields{"namespace": o.GetNamespace(), "name": o.GetName(), "priority": v}).Warn("Priority not valid")
+		return 0
+	}
+	return p
+}
+
+// precedes tells if source a wins over source b when both sync an object with the same name to the same namespace.
+// Higher priority wins, then the oldest source and lastly the source in alphabetically first namespace.
+func precedes(a, b metav1.Object) bool {
+	if pa, pb := sourcePriority(a), sourcePriority(b); pa != pb {
+		return pa > pb
+	}
+	ta, tb := a.GetCreationTimestamp(), b.GetCreationTimestamp()
+	if !ta.Equal(&tb) {
+		return ta.Before(&tb)
+	}
+	return a.GetNamespace() < b.GetNamespace()
+}
+
+// isOrigin tells if the synced copy was created from source
+func (m *syncMetadata) isOrigin(source metav1.Object) bool {
+	return m.Namespace == source.GetNamespace() && m.Name == source.GetName()
+}
+
+func (m *syncMetadata) originKey() string {
+	return fmt.Sprintf("%s/%s", m.Namespace, m.Name)
+}
+
+// collidingSource returns the other source that owns the copy in namespace ns if it wins over source.
+// Returns nil if source is free to take over the copy.
+func (c *Controller) collidingSource(source metav1.Object, m *syncMetadata, ns string, get sourceGetter) (metav1.Object, error) {
+	if m.isOrigin(source) {
+		return nil, nil
+	}
+
+	other, err := get(m.Namespace, m.Name)
+	if err != nil {
+		if errors.IsNotFound(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	if !isSource(other.GetAnnotations()) {
+		return nil, nil
+	}
+
+	t, err := targetFromAnnotations(other.GetAnnotations())
+	if err != nil {
+		return nil, nil
+	}
+	namespace, err := c.namespacesLister.Get(ns)
+	if err != nil {
+		return nil, err
+	}
+	if !c.namespaceTargeted(t, namespace) || !precedes(other, source) {
+		return nil, nil
+	}
+	return other, nil
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSyncCollision(t *testing.T) {
+	older := newSource("a", "foo", "c", "old", 2*time.Hour)
+	newer := newSource("b", "foo", "c", "new", time.Hour)
+
+	t.Run("loser leaves copy alone", func(t *testing.T) {
+		f := newFixture(t, newNamespace("a"), newNamespace("b"), newNamespace("c"), older, newer)
+		f.add(f.copyOf(older, "c"))
+
+		if err := f.secrets().sync("b/foo", false); err != nil {
+			t.Fatal(err)
+		}
+		if copy := f.secret("c", "foo"); origin(copy) != "a/foo" || string(copy.Data["key"]) != "old" {
+			t.Errorf("copy taken over by losing source: %v", copy)
+		}
+		if s := f.status(newer); s.Failures["c"] != "collision with a/foo" {
+			t.Errorf("status failures %v, want collision in c", s.Failures)
+		}
+		f.expectEvent("Collision with a/foo in namespace c")
+	})
+
+	t.Run("winner takes copy over", func(t *testing.T) {
+		f := newFixture(t, newNamespace("a"), newNamespace("b"), newNamespace("c"), older, newer)
+		f.add(f.copyOf(newer, "c"))
+
+		if err := f.secrets().sync("a/foo", false); err != nil {
+			t.Fatal(err)
+		}
+		if copy := f.secret("c", "foo"); origin(copy) != "a/foo" || string(copy.Data["key"]) != "old" {
+			t.Errorf("copy not taken over by older source: %v", copy)
+		}
+	})
+
+	t.Run("priority wins over age", func(t *testing.T) {
+		priority := newer.DeepCopy()
+		priority.Annotations[priorityAnnotation] = "10"
+		f := newFixture(t, newNamespace("a"), newNamespace("b"), newNamespace("c"), older, priority)
+		f.add(f.copyOf(older, "c"))
+
+		if err := f.secrets().sync("b/foo", false); err != nil {
+			t.Fatal(err)
+		}
+		if copy := f.secret("c", "foo"); origin(copy) != "b/foo" {
+			t.Errorf("copy not taken over by source with higher priority: %v", copy)
+		}
+
+		f.events()
+		f.refresh()
+		if err := f.secrets().sync("a/foo", false); err != nil {
+			t.Fatal(err)
+		}
+		f.expectEvent("Collision with b/foo in namespace c")
+	})
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"bytes"
+)
+
+// managedAnnotations are maintained by konfig-syncer on the copies and ignored when comparing them to the source
+var managedAnnotations = []string{metadataAnnotation}
+
+func stringMapsEqual(a, b map[string]string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for k, v := range a {
+		if bv, ok := b[k]; !ok || bv != v {
+			return false
+		}
+	}
+	return true
+}
+
+func byteMapsEqual(a, b map[string][]byte) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for k, v := range a {
+		if bv, ok := b[k]; !ok || !bytes.Equal(bv, v) {
+			return false
+		}
+	}
+	return true
+}
+
+// copyAnnotationsEqual compares annotations of desired and actual copy ignoring the ones managed by konfig-syncer
+func copyAnnotationsEqual(desired, actual map[string]string) bool {
+	return stringMapsEqual(withoutManagedAnnotations(desired), withoutManagedAnnotations(actual))
+}
+
+// sourceAnnotationsEqual compares annotations of two versions of a source ignoring the sync status
+func sourceAnnotationsEqual(old, new map[string]string) bool {
+	a := make(map[string]string, len(old))
+	for k, v := range old {
+		a[k] = v
+	}
+	b := make(map[string]string, len(new))
+	for k, v := range new {
+		b[k] = v
+	}
+	delete(a, statusAnnotation)
+	delete(b, statusAnnotation)
+	return stringMapsEqual(a, b)
+}
+
+func withoutManagedAnnotations(annotations map[string]string) map[string]string {
+	a := make(map[string]string, len(annotations))
+	for k, v := range annotations {
+		a[k] = v
+	}
+	for _, k := range managedAnnotations {
+		delete(a, k)
+	}
+	return a
+}
@@ -1,122 +1,109 @@
 package main
-import (
-	"fmt"
-	"reflect"
-	"time"
 
-	log "github.com/sirupsen/logrus"
+import (
 	corev1 "k8s.io/api/core/v1"
-	"k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
-	"k8s.io/apimachinery/pkg/util/runtime"
+	"k8s.io/apimachinery/pkg/labels"
+	coreinformers "k8s.io/client-go/informers/core/v1"
+	corev1client "k8s.io/client-go/kubernetes/typed/core/v1"
+	corelisters "k8s.io/client-go/listers/core/v1"
 	"k8s.io/client-go/tools/cache"
-
 )
 
-func (c *Controller) syncConfigMap(key string) error {
-	obj, exists, _ := c.deletedConfigMapIndexer.GetByKey(key)
-	if exists {
-		log.Debug("Cleanup configmaps that were added by old origin ConfigMap")
-		c.deletedConfigMapIndexer.Delete(key)
-		s := obj.(*corev1.ConfigMap)
-		c.deleteSyncedConfigMaps(s)
-	}
+// configMapKind adapts ConfigMaps for the reconciler
+type configMapKind struct {
+	client corev1client.ConfigMapsGetter
+	lister corelisters.ConfigMapLister
+	synced cache.InformerSynced
+}
 
-	namespace, name, err := cache.SplitMetaNamespaceKey(key)
-	if err != nil {
-		runtime.HandleError(fmt.Errorf("invalid resource key: %s", key))
-		return nil
+func newConfigMapKind(client corev1client.ConfigMapsGetter, informer coreinformers.ConfigMapInformer) *configMapKind {
+	return &configMapKind{
+		client: client,
+		lister: informer.Lister(),
+		synced: informer.Informer().HasSynced,
 	}
+}
 
-	sourceConfigMap, err := c.configMapsLister.ConfigMaps(namespace).Get(name)
+func (k *configMapKind) Kind() string {
+	return "ConfigMap"
+}
+
+func (k *configMapKind) Synced() bool {
+	return k.synced()
+}
+
+func (k *configMapKind) Get(namespace, name string) (object, error) {
+	cm, err := k.lister.ConfigMaps(namespace).Get(name)
 	if err != nil {
-		if errors.IsNotFound(err) {
-          return nil
-		}
-		return err
+		return nil, err
 	}
+	return cm, nil
+}
 
-	namespaces, err := c.namespacesForLabel(sourceConfigMap.Annotations[syncAnnotation])
+func (k *configMapKind) List(namespace string) ([]object, error) {
+	var configMaps []*corev1.ConfigMap
+	var err error
+	if namespace == "" {
+		configMaps, err = k.lister.List(labels.Everything())
+	} else {
+		configMaps, err = k.lister.ConfigMaps(namespace).List(labels.Everything())
+	}
 	if err != nil {
-		return nil
+		return nil, err
 	}
-
-	newConfigMap := createNewConfigMap(sourceConfigMap)
-	for _, ns := range namespaces.UnsortedList() {
-		if ns == sourceConfigMap.Namespace {
-			continue
-		}
-
-		targetConfigMap, err := c.configMapsLister.ConfigMaps(ns).Get(newConfigMap.Name)
-		if err != nil {
-			if errors.IsNotFound(err) {
-				_, err = c.kubeclientset.CoreV1().ConfigMaps(ns).Create(newConfigMap)
-				if err != nil {
-					log.Error(err)
-				}
-				log.WithFields(log.Fields{"configMap": newConfigMap.Name, "namespace": ns}).Info("ConfigMap added")
-			} else {
-				log.Error(err)
-			}
-			continue
-		}
-
-		if reflect.DeepEqual(targetConfigMap.Data, newConfigMap.Data) {
-			log.WithFields(log.Fields{"configMap": newConfigMap.Name, "namespace": ns}).Debug("Data hasn't changed, dont sync")
-			continue
-		}
-		_, err = c.kubeclientset.CoreV1().ConfigMaps(ns).Update(newConfigMap)
-		if err != nil {
-			log.Error(err)
-		}
-		log.WithFields(log.Fields{"configMap": newConfigMap.Name, "namespace": ns}).Info("ConfigMap updated")
+	objs := make([]object, 0, len(configMaps))
+	for _, cm := range configMaps {
+		objs = append(objs, cm)
 	}
-	return nil
+	return objs, nil
 }
 
-func (c *Controller) deleteSyncedConfigMaps(s *corev1.ConfigMap) {
-	log.Debug("ConfigMap was deleted, lets delete the synced copies")
-	namespaces, err := c.namespacesForLabel(s.Annotations[syncAnnotation])
+func (k *configMapKind) Fetch(namespace, name string) (object, error) {
+	cm, err := k.client.ConfigMaps(namespace).Get(name, metav1.GetOptions{})
 	if err != nil {
-		log.Error(err)
-		return
+		return nil, err
 	}
+	return cm, nil
+}
+
+func (k *configMapKind) Create(obj object) error {
+	_, err := k.client.ConfigMaps(obj.GetNamespace()).Create(obj.(*corev1.ConfigMap))
+	return err
+}
 
-	for _, ns := range namespaces.UnsortedList() {
-		if ns == s.Namespace {
-			continue
-		}
-		err = c.kubeclientset.CoreV1().ConfigMaps(ns).Delete(s.Name, &metav1.DeleteOptions{})
-		if err != nil {
-			log.Error(err)
-		}
-		log.WithFields(log.Fields{"ConfigMap": s.Name, "namespace": ns}).Info("ConfigMap deleted")
+func (k *configMapKind) Update(obj object) (object, error) {
+	cm, err := k.client.ConfigMaps(obj.GetNamespace()).Update(obj.(*corev1.ConfigMap))
+	if err != nil {
+		return nil, err
 	}
+	return cm, nil
 }
 
+func (k *configMapKind) Delete(namespace, name string, options *metav1.DeleteOptions) error {
+	return k.client.ConfigMaps(namespace).Delete(name, options)
+}
 
+func (k *configMapKind) Desired(source object) object {
+	return source.(*corev1.ConfigMap).DeepCopy()
+}
 
-func createNewConfigMap(sourceConfigMap *corev1.ConfigMap) *corev1.ConfigMap {
-	newConfigMap := sourceConfigMap.DeepCopy()
+// Equal compares the payload of two ConfigMaps
+func (k *configMapKind) Equal(a, b object) bool {
+	ca, cb := a.(*corev1.ConfigMap), b.(*corev1.ConfigMap)
+	return stringMapsEqual(ca.Data, cb.Data) && byteMapsEqual(ca.BinaryData, cb.BinaryData)
+}
 
-	delete(newConfigMap.Annotations, syncAnnotation)
-	newConfigMap.ResourceVersion = ""
-	newConfigMap.Namespace = ""
-	newConfigMap.UID = ""
-	newConfigMap.GenerateName = ""
-	newConfigMap.SelfLink = ""
-	newConfigMap.CreationTimestamp.Reset()
-	if newConfigMap.Annotations == nil {
-		newConfigMap.Annotations = make(map[string]string)
-	}
-	kubeSyncAnnotationValue := fmt.Sprintf(`{"namespace":%q,"name":%q,"uid":%q,"resourceVersion":%q,"label":%q,"last-update":%q}`,
-		sourceConfigMap.Namespace,
-		sourceConfigMap.Name,
-		sourceConfigMap.UID,
-		sourceConfigMap.ResourceVersion,
-		sourceConfigMap.Annotations[syncAnnotation],
-		time.Now().String())
-	newConfigMap.Annotations[fmt.Sprintf("%s-%s", syncAnnotation, "metadata")] = kubeSyncAnnotationValue
-	return newConfigMap
+// Hash returns hash of the ConfigMap content used for naming versioned copies
+func (k *configMapKind) Hash(obj object) string {
+	cm := obj.(*corev1.ConfigMap)
+	return contentHash(struct {
+		Data       map[string]string
+		BinaryData map[string][]byte
+	}{cm.Data, cm.BinaryData})
 }
 
+// NeedsRecreate is always false, immutable ConfigMaps are detected from the update error
+func (k *configMapKind) NeedsRecreate(desired, actual object) bool {
+	return false
+}
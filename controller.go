@@ -7,35 +7,102 @@ import (
 
 	log "github.com/sirupsen/logrus"
 	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/util/runtime"
 	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	"k8s.io/apimachinery/pkg/util/sets"
 	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/dynamic/dynamicinformer"
 	coreinformers "k8s.io/client-go/informers/core/v1"
 	"k8s.io/client-go/kubernetes"
 	corelisters "k8s.io/client-go/listers/core/v1"
 	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/tools/record"
 	"k8s.io/client-go/util/workqueue"
 )
 
 const syncAnnotation string = "konfig-syncer"
 
-// Controller is responsible for watching Secret/Configmap events and adding them to WQ for processing
-type Controller struct {
-	kubeclientset kubernetes.Interface
+// Options holds the controller wide settings
+type Options struct {
+	// ExcludeNamespaces are never used as sync targets
+	ExcludeNamespaces []string
+	// ExcludeNamespaceSelector matches namespaces that are never used as sync targets
+	ExcludeNamespaceSelector labels.Selector
+	// AdoptionPolicy decides what to do with existing objects not created by konfig-syncer
+	AdoptionPolicy string
+	// LabelAllowlist and LabelDenylist decide which labels are copied from the source
+	LabelAllowlist []string
+	LabelDenylist  []string
+	// AnnotationAllowlist and AnnotationDenylist decide which annotations are copied from the source
+	AnnotationAllowlist []string
+	AnnotationDenylist  []string
+	// GCInterval is how often orphaned copies are garbage collected, 0 disables garbage collection
+	GCInterval time.Duration
+	// GCDryRun only reports orphaned copies instead of deleting them
+	GCDryRun bool
+	// MaxDeletions is the maximum number of copies deleted at once without confirmation, 0 disables the check
+	MaxDeletions int
+	// MaxDeletionPercent is the maximum percentage of copies deleted at once without confirmation, 0 disables the check
+	MaxDeletionPercent int
+	// DeletionGracePeriod is how long copies stay marked for deletion before they are deleted, 0 deletes immediately
+	DeletionGracePeriod time.Duration
+	// WorkerTimeout is how long workers can be busy without progress before liveness check fails
+	WorkerTimeout time.Duration
+	// LeaderElection makes replicas campaign for a Lease and only the leader run workers, nil disables it
+	LeaderElection *LeaderElection
+	// MaxRetries is how many times a failing item is retried before giving up, 0 retries forever
+	MaxRetries int
+	// Resources are the namespaced kinds synced through the dynamic client in addition to Secrets and ConfigMaps
+	Resources []Resource
+	// TargetConcurrency is how many copies are written concurrently across all workers
+	TargetConcurrency int
+	// MaxWritesPerSync is how many copies a single sync of a source writes before leaving the rest for the next pass, 0 is unlimited
+	MaxWritesPerSync int
+}
 
-	configMapsLister        corelisters.ConfigMapLister
-	configMapsSynced        cache.InformerSynced
-	configMapWorkqueue      workqueue.RateLimitingInterface
-	deletedConfigMapIndexer cache.Indexer
+// LeaderElection holds the Lease used for electing the replica that runs the workers
+type LeaderElection struct {
+	Namespace     string
+	Name          string
+	LeaseDuration time.Duration
+	RenewDeadline time.Duration
+	RetryPeriod   time.Duration
+}
 
-	secretsLister        corelisters.SecretLister
-	secretsSynced        cache.InformerSynced
-	secretWorkqueue      workqueue.RateLimitingInterface
-	deletedSecretIndexer cache.Indexer
+// Controller is responsible for watching sources and namespaces and adding them to WQ for processing
+type Controller struct {
+	kubeclientset kubernetes.Interface
+	recorder      record.EventRecorder
 
 	namespacesLister   corelisters.NamespaceLister
 	namespacesSynced   cache.InformerSynced
 	namespaceWorkqueue workqueue.RateLimitingInterface
+
+	reconcilers []*reconciler
+
+	excludeNamespaces        sets.String
+	excludeNamespaceSelector labels.Selector
+	defaultAdoptionPolicy    string
+	labelAllowlist           []string
+	labelDenylist            []string
+	annotationAllowlist      []string
+	annotationDenylist       []string
+	gcInterval               time.Duration
+	gcDryRun                 bool
+	deletionGuard            deletionGuard
+	deletionGracePeriod      time.Duration
+
+	heartbeats    map[string]*heartbeat
+	workerTimeout time.Duration
+	maxRetries    int
+
+	writeSlots       chan struct{}
+	maxWritesPerSync int
+
+	leaderElection *LeaderElection
+	isLeader       int32
 }
 
 // NewController creates controller FIXME proper comment
@@ -43,98 +110,49 @@ func NewController(
 	kubeclientset kubernetes.Interface,
 	configMapInformer coreinformers.ConfigMapInformer,
 	secretInformer coreinformers.SecretInformer,
-	namespaceInformer coreinformers.NamespaceInformer) *Controller {
+	namespaceInformer coreinformers.NamespaceInformer,
+	dynamicClient dynamic.Interface,
+	dynamicInformerFactory dynamicinformer.DynamicSharedInformerFactory,
+	opts Options) *Controller {
 
 	controller := &Controller{
-		kubeclientset:           kubeclientset,
-		configMapsLister:        configMapInformer.Lister(),
-		configMapsSynced:        configMapInformer.Informer().HasSynced,
-		configMapWorkqueue:      workqueue.NewNamedRateLimitingQueue(workqueue.DefaultControllerRateLimiter(), "ConfigMaps"),
-		deletedConfigMapIndexer: cache.NewIndexer(cache.DeletionHandlingMetaNamespaceKeyFunc, cache.Indexers{}),
-		secretsLister:           secretInformer.Lister(),
-		secretsSynced:           secretInformer.Informer().HasSynced,
-		secretWorkqueue:         workqueue.NewNamedRateLimitingQueue(workqueue.DefaultControllerRateLimiter(), "Secrets"),
-		deletedSecretIndexer:    cache.NewIndexer(cache.DeletionHandlingMetaNamespaceKeyFunc, cache.Indexers{}),
-		namespacesLister:        namespaceInformer.Lister(),
-		namespacesSynced:        namespaceInformer.Informer().HasSynced,
-		namespaceWorkqueue:      workqueue.NewNamedRateLimitingQueue(workqueue.DefaultControllerRateLimiter(), "Namespaces"),
-	}
-
-	secretInformer.Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
-		AddFunc: func(new interface{}) {
-			s := new.(*corev1.Secret)
-			if _, ok := s.Annotations[syncAnnotation]; ok {
-				log.Debug("Secret added to workqueue")
-				controller.enqueueSecret(new)
-			}
-		},
-		UpdateFunc: func(old, new interface{}) {
-			news := new.(*corev1.Secret)
-			olds := old.(*corev1.Secret)
-			nanno, newHasAnno := news.Annotations[syncAnnotation]
-			oanno, oldHasAnno := olds.Annotations[syncAnnotation]
-
-			if newHasAnno && (!oldHasAnno || !reflect.DeepEqual(news.Data, olds.Data)) {
-				log.Debug("Secret updated to have sync annotation or data changed")
-				controller.enqueueSecret(news)
-			} else if !newHasAnno && oldHasAnno {
-				log.Debug("Sync annotation was removed from Secret")
-				controller.deletedSecretIndexer.Add(olds)
-				controller.enqueueSecret(news)
-			} else {
-				if !reflect.DeepEqual(nanno, oanno) {
-					log.Debug("Sync annotation was was changed on secret")
-					controller.deletedSecretIndexer.Add(olds)
-					controller.enqueueSecret(news)
-				}
-			}
-		},
-		DeleteFunc: func(obj interface{}) {
-			log.Debug("Secret deleted")
-			s := obj.(*corev1.Secret)
-			if _, ok := s.Annotations[syncAnnotation]; ok {
-				controller.enqueueSecret(obj)
-				controller.deletedSecretIndexer.Add(obj)
-			}
+		kubeclientset:            kubeclientset,
+		recorder:                 newEventRecorder(kubeclientset),
+		namespacesLister:         namespaceInformer.Lister(),
+		namespacesSynced:         namespaceInformer.Informer().HasSynced,
+		namespaceWorkqueue:       workqueue.NewNamedRateLimitingQueue(workqueue.DefaultControllerRateLimiter(), "Namespaces"),
+		excludeNamespaces:        sets.NewString(opts.ExcludeNamespaces...),
+		excludeNamespaceSelector: opts.ExcludeNamespaceSelector,
+		defaultAdoptionPolicy:    opts.AdoptionPolicy,
+		labelAllowlist:           opts.LabelAllowlist,
+		labelDenylist:            opts.LabelDenylist,
+		annotationAllowlist:      opts.AnnotationAllowlist,
+		annotationDenylist:       opts.AnnotationDenylist,
+		gcInterval:               opts.GCInterval,
+		gcDryRun:                 opts.GCDryRun,
+		deletionGuard:            deletionGuard{maxCount: opts.MaxDeletions, maxPercent: opts.MaxDeletionPercent},
+		deletionGracePeriod:      opts.DeletionGracePeriod,
+		heartbeats: map[string]*heartbeat{
+			"Namespaces": newHeartbeat(),
 		},
-	})
+		workerTimeout:  opts.WorkerTimeout,
+		maxRetries:     opts.MaxRetries,
+		leaderElection: opts.LeaderElection,
+	}
 
-	configMapInformer.Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
-		AddFunc: func(new interface{}) {
-			s := new.(*corev1.ConfigMap)
-			if _, ok := s.Annotations[syncAnnotation]; ok {
-				log.Debug("ConfigMap added to workqueue")
-				controller.enqueueConfigMap(s)
-			}
-		},
-		UpdateFunc: func(old, new interface{}) {
-			news := new.(*corev1.ConfigMap)
-			olds := old.(*corev1.ConfigMap)
-
-			nanno, newHasAnno := news.Annotations[syncAnnotation]
-			oanno, oldHasAnno := olds.Annotations[syncAnnotation]
-
-			if newHasAnno && (!oldHasAnno || !reflect.DeepEqual(news.Data, olds.Data)) {
-				log.Debug("ConfigMap updated to have sync annotation or data changed")
-				controller.enqueueConfigMap(news)
-			} else if !newHasAnno && oldHasAnno {
-				log.Debug("Sync annotation was removed from ConfigMap")
-				controller.deletedConfigMapIndexer.Add(olds)
-			} else if !reflect.DeepEqual(nanno, oanno) {
-				log.Debug("Sync annotation was was changed on ConfigMap")
-				controller.deletedConfigMapIndexer.Add(olds)
-				controller.enqueueConfigMap(news)
-			}
-		},
-		DeleteFunc: func(obj interface{}) {
-			s := obj.(*corev1.ConfigMap)
-			if _, ok := s.Annotations[syncAnnotation]; ok {
-				log.Debug("ConfigMap deleted")
-				controller.enqueueConfigMap(obj)
-				controller.deletedConfigMapIndexer.Add(obj)
-			}
-		},
-	})
+	concurrency := opts.TargetConcurrency
+	if concurrency < 1 {
+		concurrency = 1
+	}
+	controller.writeSlots = make(chan struct{}, concurrency)
+	controller.maxWritesPerSync = opts.MaxWritesPerSync
+
+	controller.addReconciler(newReconciler(controller, newSecretKind(kubeclientset.CoreV1(), secretInformer), "Secrets"), secretInformer.Informer())
+	controller.addReconciler(newReconciler(controller, newConfigMapKind(kubeclientset.CoreV1(), configMapInformer), "ConfigMaps"), configMapInformer.Informer())
+	for _, r := range opts.Resources {
+		informer := dynamicInformerFactory.ForResource(r.GroupVersionResource)
+		controller.addReconciler(newReconciler(controller, newDynamicKind(r, dynamicClient, informer), r.GroupResource().String()), informer.Informer())
+	}
 
 	namespaceInformer.Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
 		AddFunc: func(new interface{}) {
@@ -145,7 +163,9 @@ func NewController(
 			newNs := new.(*corev1.Namespace)
 			oldNs := old.(*corev1.Namespace)
 
-			if newNs.Status.Phase != corev1.NamespaceTerminating && !reflect.DeepEqual(newNs.Labels, oldNs.Labels) {
+			labelsChanged := !reflect.DeepEqual(newNs.Labels, oldNs.Labels)
+			confirmed := deletionConfirmed(newNs.Annotations) && !deletionConfirmed(oldNs.Annotations)
+			if newNs.Status.Phase != corev1.NamespaceTerminating && (labelsChanged || confirmed) {
 				log.Debug("Namespace added to workqueue on update")
 				controller.enqueueNamespace(newNs)
 			}
@@ -156,51 +176,56 @@ func NewController(
 	return controller
 }
 
+// addReconciler registers reconciler of a kind and the handlers on the informer of that kind
+func (c *Controller) addReconciler(r *reconciler, informer cache.SharedIndexInformer) {
+	c.reconcilers = append(c.reconcilers, r)
+	c.heartbeats[r.name] = newHeartbeat()
+	informer.AddEventHandler(r.handlers())
+}
+
 // Run spins up the controller
 func (c *Controller) Run(threadiness int, stopCh <-chan struct{}) error {
 	defer utilruntime.HandleCrash()
-	defer c.configMapWorkqueue.ShutDown()
-	defer c.secretWorkqueue.ShutDown()
 	defer c.namespaceWorkqueue.ShutDown()
+	for _, r := range c.reconcilers {
+		defer r.queue.ShutDown()
+	}
 
 	// Wait for the caches to be synced before starting workers
 	log.Info("Waiting for informer caches to sync")
-	if ok := cache.WaitForCacheSync(stopCh, c.configMapsSynced, c.secretsSynced); !ok {
+	cachesSynced := []cache.InformerSynced{c.namespacesSynced}
+	for _, r := range c.reconcilers {
+		cachesSynced = append(cachesSynced, r.kind.Synced)
+	}
+	if ok := cache.WaitForCacheSync(stopCh, cachesSynced...); !ok {
 		return fmt.Errorf("failed to wait for caches to sync")
 	}
 
+	if c.leaderElection != nil {
+		return c.runLeaderElected(threadiness, stopCh)
+	}
+	c.runWorkers(threadiness, stopCh)
+	return nil
+}
+
+// runWorkers processes the queues until stopCh is closed
+func (c *Controller) runWorkers(threadiness int, stopCh <-chan struct{}) {
 	log.Info("Starting workers")
 	for i := 0; i < threadiness; i++ {
-		go wait.Until(c.runConfigMapWorker, time.Second, stopCh)
-		go wait.Until(c.runSecretWorker, time.Second, stopCh)
 		go wait.Until(c.runNamespaceWorker, time.Second, stopCh)
+		for _, r := range c.reconcilers {
+			go wait.Until(r.runWorker, time.Second, stopCh)
+		}
 	}
 
+	if c.gcInterval > 0 {
+		go wait.Until(c.collectGarbage, c.gcInterval, stopCh)
+	}
+
+	c.setLeading(true)
 	log.Info("Started workers")
 	<-stopCh
 	log.Info("Shutting down workers")
-
-	return nil
-}
-
-func (c *Controller) enqueueSecret(obj interface{}) {
-	var key string
-	var err error
-	if key, err = cache.DeletionHandlingMetaNamespaceKeyFunc(obj); err != nil {
-		runtime.HandleError(err)
-		return
-	}
-	c.secretWorkqueue.AddRateLimited(key)
-}
-
-func (c *Controller) enqueueConfigMap(obj interface{}) {
-	var key string
-	var err error
-	if key, err = cache.DeletionHandlingMetaNamespaceKeyFunc(obj); err != nil {
-		runtime.HandleError(err)
-		return
-	}
-	c.configMapWorkqueue.AddRateLimited(key)
 }
 
 func (c *Controller) enqueueNamespace(obj interface{}) {
@@ -210,17 +235,8 @@ func (c *Controller) enqueueNamespace(obj interface{}) {
 		runtime.HandleError(err)
 		return
 	}
-	c.namespaceWorkqueue.AddRateLimited(key)
-}
-
-func (c *Controller) runConfigMapWorker() {
-	for c.processNextConfigMap() {
-	}
-}
-
-func (c *Controller) runSecretWorker() {
-	for c.processNextSecret() {
-	}
+	//Only failures are rate limited, so events dont count as retries
+	c.namespaceWorkqueue.Add(key)
 }
 
 func (c *Controller) runNamespaceWorker() {
@@ -228,76 +244,6 @@ func (c *Controller) runNamespaceWorker() {
 	}
 }
 
-func (c *Controller) processNextConfigMap() bool {
-	obj, shutdown := c.configMapWorkqueue.Get()
-
-	if shutdown {
-		return false
-	}
-
-	err := func(obj interface{}) error {
-		defer c.configMapWorkqueue.Done(obj)
-		var key string
-		var ok bool
-
-		if key, ok = obj.(string); !ok {
-			c.configMapWorkqueue.Forget(obj)
-			utilruntime.HandleError(fmt.Errorf("expected string in workqueue but got %#v", obj))
-			return nil
-		}
-
-		if err := c.syncConfigMap(key); err != nil {
-			c.configMapWorkqueue.AddRateLimited(key)
-			return fmt.Errorf("error syncing '%s': %s, requeuing", key, err.Error())
-		}
-
-		c.configMapWorkqueue.Forget(obj)
-		return nil
-	}(obj)
-
-	if err != nil {
-		utilruntime.HandleError(err)
-		return true
-	}
-
-	return true
-}
-
-func (c *Controller) processNextSecret() bool {
-	obj, shutdown := c.secretWorkqueue.Get()
-
-	if shutdown {
-		return false
-	}
-
-	err := func(obj interface{}) error {
-		defer c.secretWorkqueue.Done(obj)
-		var key string
-		var ok bool
-
-		if key, ok = obj.(string); !ok {
-			c.secretWorkqueue.Forget(obj)
-			utilruntime.HandleError(fmt.Errorf("expected string in workqueue but got %#v", obj))
-			return nil
-		}
-
-		if err := c.syncSecret(key); err != nil {
-			c.secretWorkqueue.AddRateLimited(key)
-			return fmt.Errorf("error syncing '%s': %s, requeuing", key, err.Error())
-		}
-
-		c.secretWorkqueue.Forget(obj)
-		return nil
-	}(obj)
-
-	if err != nil {
-		utilruntime.HandleError(err)
-		return true
-	}
-
-	return true
-}
-
 func (c *Controller) processNextNamespace() bool {
 	obj, shutdown := c.namespaceWorkqueue.Get()
 
@@ -307,6 +253,8 @@ func (c *Controller) processNextNamespace() bool {
 
 	err := func(obj interface{}) error {
 		defer c.namespaceWorkqueue.Done(obj)
+		hb := c.heartbeats["Namespaces"]
+		defer hb.finish(hb.start())
 		var key string
 		var ok bool
 
@@ -316,7 +264,15 @@ func (c *Controller) processNextNamespace() bool {
 			return nil
 		}
 
-		if err := c.syncNamespace(key); err != nil {
+		start := time.Now()
+		err := c.syncNamespace(key)
+		syncDuration.WithLabelValues("syncNamespace").Observe(time.Since(start).Seconds())
+		if err != nil && c.retriesExhausted(c.namespaceWorkqueue.NumRequeues(key)) {
+			c.namespaceWorkqueue.Forget(obj)
+			deadLetters.WithLabelValues("Namespace").Inc()
+			return fmt.Errorf("error syncing '%s': %s, giving up after %d retries", key, err.Error(), c.maxRetries)
+		}
+		if err != nil {
 			c.namespaceWorkqueue.AddRateLimited(key)
 			return fmt.Errorf("error syncing '%s': %s, requeuing", key, err.Error())
 		}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/util/workqueue"
+)
+
+const (
+	deletionPolicyAnnotation string = syncAnnotation + "/deletion-policy"
+
+	// deletionPolicyDelete deletes copies when they are no longer wanted
+	deletionPolicyDelete string = "delete"
+	// deletionPolicyOrphan strips the sync metadata from copies and leaves the data in place
+	deletionPolicyOrphan string = "orphan"
+	// deletionPolicyRetain keeps managed copies frozen in their last synced state
+	deletionPolicyRetain string = "retain"
+
+	// deleteAfterAnnotation marks a copy for deletion once the RFC3339 deadline in the value has passed
+	deleteAfterAnnotation string = syncAnnotation + "/delete-after"
+)
+
+// deletionPolicy returns the deletion policy of source, defaults to delete
+func deletionPolicy(source metav1.Object) string {
+	policy, ok := source.GetAnnotations()[deletionPolicyAnnotation]
+	if !ok {
+		return deletionPolicyDelete
+	}
+	switch policy {
+	case deletionPolicyDelete, deletionPolicyOrphan, deletionPolicyRetain:
+		return policy
+	}
+	log.WithFields(log.Fields{"namespace": source.GetNamespace(), "name": source.GetName(), "policy": policy}).Warn("Deletion policy not valid")
+	return deletionPolicyDelete
+}
+
+// deletionPolicy returns the deletion policy recorded on the copy at last sync
+func (m *syncMetadata) deletionPolicy() string {
+	switch m.DeletionPolicy {
+	case deletionPolicyOrphan, deletionPolicyRetain:
+		return m.DeletionPolicy
+	}
+	return deletionPolicyDelete
+}
+
+// deletionDeadline returns the deadline of a copy marked for deletion
+func deletionDeadline(annotations map[string]string) (time.Time, bool) {
+	v, ok := annotations[deleteAfterAnnotation]
+	if !ok {
+		return time.Time{}, false
+	}
+	deadline, err := time.Parse(time.RFC3339, v)
+	if err != nil {
+		log.WithFields(log.Fields{"deadline": v}).Warn("Deletion deadline not valid")
+		return time.Time{}, false
+	}
+	return deadline, true
+}
+
+// markedForDeletion tells if the copy is waiting for its grace period to pass
+func markedForDeletion(annotations map[string]string) bool {
+	_, ok := annotations[deleteAfterAnnotation]
+	return ok
+}
+
+// deletionDue tells if a copy has to be deleted now. Copies not yet marked get the annotations
+// to mark them returned instead, and are deleted only after the grace period.
+func (c *Controller) deletionDue(copy metav1.Object) (bool, map[string]string) {
+	if c.deletionGracePeriod <= 0 {
+		return true, nil
+	}
+
+	deadline, marked := deletionDeadline(copy.GetAnnotations())
+	if !marked {
+		annotations := make(map[string]string, len(copy.GetAnnotations())+1)
+		for k, v := range copy.GetAnnotations() {
+			annotations[k] = v
+		}
+		annotations[deleteAfterAnnotation] = time.Now().Add(c.deletionGracePeriod).UTC().Format(time.RFC3339)
+		return false, annotations
+	}
+	return !time.Now().Before(deadline), nil
+}
+
+// scheduleDeletion revisits the copy marked for deletion once its grace period has passed
+func (c *Controller) scheduleDeletion(copy metav1.Object, origins workqueue.RateLimitingInterface) {
+	c.namespaceWorkqueue.AddAfter(copy.GetNamespace(), c.deletionGracePeriod)
+	if m, ok := metadataFromAnnotations(copy.GetAnnotations()); ok {
+		origins.AddAfter(m.originKey(), c.deletionGracePeriod)
+	}
+}
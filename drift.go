@@ -0,0 +1,47 @@
+package main
+
+import (
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/client-go/tools/cache"
+)
+
+// allowDriftAnnotation set to "true" on a synced copy lets the copy diverge from its source.
+// Local changes to the copy are kept until the source itself changes.
+const allowDriftAnnotation string = syncAnnotation + "/allow-drift"
+
+func allowsDrift(annotations map[string]string) bool {
+	return annotations[allowDriftAnnotation] == "true"
+}
+
+// unwrapTombstone returns the last known state of an object from delete event
+func unwrapTombstone(obj interface{}) interface{} {
+	if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+		return tombstone.Obj
+	}
+	return obj
+}
+
+// driftedOriginKey returns the key of the source a changed or deleted copy was synced from,
+// if the change should be reverted by syncing the source again
+func driftedOriginKey(obj interface{}) (string, bool) {
+	o, err := meta.Accessor(obj)
+	if err != nil {
+		return "", false
+	}
+
+	m, ok := metadataFromAnnotations(o.GetAnnotations())
+	if !ok || allowsDrift(o.GetAnnotations()) {
+		return "", false
+	}
+	return m.originKey(), true
+}
+
+// withAllowDrift returns copy of annotations with the allow drift opt-out set
+func withAllowDrift(annotations map[string]string) map[string]string {
+	a := make(map[string]string, len(annotations)+1)
+	for k, v := range annotations {
+		a[k] = v
+	}
+	a[allowDriftAnnotation] = "true"
+	return a
+}
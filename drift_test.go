@@ -0,0 +1,91 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+// queued returns the keys in the workqueue of r, emptying it
+func queued(r *reconciler) []string {
+	var keys []string
+	for r.queue.Len() > 0 {
+		key, _ := r.queue.Get()
+		keys = append(keys, key.(string))
+		r.queue.Done(key)
+		r.queue.Forget(key)
+	}
+	return keys
+}
+
+func TestDriftRequeuesSource(t *testing.T) {
+	source := newSource("a", "foo", "b", "v1", time.Hour)
+	f := newFixture(t, newNamespace("a"), newNamespace("b"), source)
+	r := f.secrets()
+	copy := f.copyOf(source, "b")
+
+	drifted := copy.DeepCopy()
+	drifted.ResourceVersion = "2"
+	drifted.Data["key"] = []byte("edited")
+
+	r.handlers().UpdateFunc(copy, drifted)
+	if keys := queued(r); len(keys) != 1 || keys[0] != "a/foo" {
+		t.Errorf("changed copy queued %v, want a/foo", keys)
+	}
+
+	r.handlers().UpdateFunc(copy, copy.DeepCopy())
+	if keys := queued(r); len(keys) != 0 {
+		t.Errorf("resync of unchanged copy queued %v", keys)
+	}
+
+	r.handlers().DeleteFunc(copy)
+	if keys := queued(r); len(keys) != 1 || keys[0] != "a/foo" {
+		t.Errorf("deleted copy queued %v, want a/foo", keys)
+	}
+
+	allowed := drifted.DeepCopy()
+	allowed.Annotations = withAllowDrift(allowed.Annotations)
+	r.handlers().UpdateFunc(copy, allowed)
+	if keys := queued(r); len(keys) != 0 {
+		t.Errorf("copy allowing drift queued %v", keys)
+	}
+}
+
+func TestSyncRevertsDrift(t *testing.T) {
+	source := newSource("a", "foo", "b", "v1", time.Hour)
+	f := newFixture(t, newNamespace("a"), newNamespace("b"), source)
+
+	drifted := f.copyOf(source, "b")
+	drifted.Data["key"] = []byte("edited")
+	f.add(drifted)
+
+	if err := f.secrets().sync("a/foo", false); err != nil {
+		t.Fatal(err)
+	}
+	if copy := f.secret("b", "foo"); string(copy.Data["key"]) != "v1" {
+		t.Errorf("drifted copy not reverted, has data %q", copy.Data["key"])
+	}
+}
+
+func TestSyncKeepsAllowedDrift(t *testing.T) {
+	source := newSource("a", "foo", "b", "v1", time.Hour)
+	f := newFixture(t, newNamespace("a"), newNamespace("b"), source)
+	if err := f.secrets().sync("a/foo", false); err != nil {
+		t.Fatal(err)
+	}
+	f.refresh()
+
+	drifted := f.secret("b", "foo")
+	drifted.Annotations = withAllowDrift(drifted.Annotations)
+	drifted.Data["key"] = []byte("edited")
+	if _, err := f.client.CoreV1().Secrets("b").Update(drifted); err != nil {
+		t.Fatal(err)
+	}
+	f.refresh()
+
+	if err := f.secrets().sync("a/foo", false); err != nil {
+		t.Fatal(err)
+	}
+	if copy := f.secret("b", "foo"); string(copy.Data["key"]) != "edited" {
+		t.Errorf("copy allowing drift overwritten with %q", copy.Data["key"])
+	}
+}
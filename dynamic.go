@@ -0,0 +1,262 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/api/equality"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/discovery"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/dynamic/dynamiclister"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/tools/cache"
+)
+
+// Resource is a namespaced kind synced through the dynamic client
+type Resource struct {
+	schema.GroupVersionResource
+	// Kind is resolved from discovery
+	Kind string
+	// Fields are the top level fields copied and compared, empty uses the default rule of the resource
+	Fields []string
+}
+
+// fieldRule decides which top level fields of a kind are synced
+type fieldRule struct {
+	// fields are copied to and compared with the copies, empty means all fields except metadata and status
+	fields []string
+	// immutable fields can't be updated, copies are recreated when they change
+	immutable []string
+}
+
+// defaultFieldRules holds the rules of well known kinds, other kinds sync everything except metadata and status
+var defaultFieldRules = map[schema.GroupResource]fieldRule{
+	{Group: "rbac.authorization.k8s.io", Resource: "roles"}:        {fields: []string{"rules"}},
+	{Group: "rbac.authorization.k8s.io", Resource: "rolebindings"}: {fields: []string{"roleRef", "subjects"}, immutable: []string{"roleRef"}},
+	{Group: "networking.k8s.io", Resource: "networkpolicies"}:      {fields: []string{"spec"}},
+	{Group: "", Resource: "limitranges"}:                           {fields: []string{"spec"}},
+	{Group: "", Resource: "resourcequotas"}:                        {fields: []string{"spec"}},
+}
+
+// typedResources are synced with their own typed informers
+var typedResources = map[schema.GroupResource]bool{
+	{Group: "", Resource: "secrets"}:    true,
+	{Group: "", Resource: "configmaps"}: true,
+}
+
+// parseResources parses comma separated list of group/version/resource, core resources are given as version/resource.
+// The synced fields can be overridden by appending them separated with +, e.g. example.com/v1/widgets:spec+data
+func parseResources(value string) ([]Resource, error) {
+	var resources []Resource
+	for _, spec := range splitList(value) {
+		var fields []string
+		if i := strings.Index(spec, ":"); i >= 0 {
+			for _, f := range strings.Split(spec[i+1:], "+") {
+				if f = strings.TrimSpace(f); f != "" {
+					fields = append(fields, f)
+				}
+			}
+			if len(fields) == 0 {
+				return nil, fmt.Errorf("no fields given for resource %s", spec)
+			}
+			spec = spec[:i]
+		}
+
+		var gvr schema.GroupVersionResource
+		parts := strings.Split(spec, "/")
+		switch len(parts) {
+		case 2:
+			gvr = schema.GroupVersionResource{Version: parts[0], Resource: parts[1]}
+		case 3:
+			gvr = schema.GroupVersionResource{Group: parts[0], Version: parts[1], Resource: parts[2]}
+		default:
+			return nil, fmt.Errorf("resource %s is not in group/version/resource format", spec)
+		}
+		if gvr.Version == "" || gvr.Resource == "" {
+			return nil, fmt.Errorf("resource %s is not in group/version/resource format", spec)
+		}
+		if typedResources[gvr.GroupResource()] {
+			return nil, fmt.Errorf("resource %s is always synced and can't be configured", spec)
+		}
+		for _, f := range fields {
+			if f == "apiVersion" || f == "kind" || f == "metadata" {
+				return nil, fmt.Errorf("field %s of resource %s can't be synced", f, spec)
+			}
+		}
+		resources = append(resources, Resource{GroupVersionResource: gvr, Fields: fields})
+	}
+	return resources, nil
+}
+
+// resolveResources looks up the kind of every resource from discovery and checks it's namespaced
+func resolveResources(client discovery.DiscoveryInterface, resources []Resource) error {
+	for i, r := range resources {
+		list, err := client.ServerResourcesForGroupVersion(r.GroupVersion().String())
+		if err != nil {
+			return fmt.Errorf("resource %s: %v", r.GroupResource(), err)
+		}
+		found := false
+		for _, api := range list.APIResources {
+			if api.Name != r.Resource {
+				continue
+			}
+			if !api.Namespaced {
+				return fmt.Errorf("resource %s is not namespaced", r.GroupResource())
+			}
+			resources[i].Kind = api.Kind
+			found = true
+			break
+		}
+		if !found {
+			return fmt.Errorf("resource %s not found in %s", r.Resource, r.GroupVersion())
+		}
+	}
+	return nil
+}
+
+// dynamicKind adapts objects of a configured resource for the reconciler
+type dynamicKind struct {
+	kind   string
+	client dynamic.NamespaceableResourceInterface
+	lister dynamiclister.Lister
+	synced cache.InformerSynced
+	rule   fieldRule
+}
+
+func newDynamicKind(r Resource, client dynamic.Interface, informer informers.GenericInformer) *dynamicKind {
+	rule := defaultFieldRules[r.GroupResource()]
+	if len(r.Fields) > 0 {
+		rule = fieldRule{fields: r.Fields}
+	}
+	return &dynamicKind{
+		kind:   r.Kind,
+		client: client.Resource(r.GroupVersionResource),
+		lister: dynamiclister.New(informer.Informer().GetIndexer(), r.GroupVersionResource),
+		synced: informer.Informer().HasSynced,
+		rule:   rule,
+	}
+}
+
+func (k *dynamicKind) Kind() string {
+	return k.kind
+}
+
+func (k *dynamicKind) Synced() bool {
+	return k.synced()
+}
+
+func (k *dynamicKind) Get(namespace, name string) (object, error) {
+	u, err := k.lister.Namespace(namespace).Get(name)
+	if err != nil {
+		return nil, err
+	}
+	return u, nil
+}
+
+func (k *dynamicKind) List(namespace string) ([]object, error) {
+	var list []*unstructured.Unstructured
+	var err error
+	if namespace == "" {
+		list, err = k.lister.List(labels.Everything())
+	} else {
+		list, err = k.lister.Namespace(namespace).List(labels.Everything())
+	}
+	if err != nil {
+		return nil, err
+	}
+	objs := make([]object, 0, len(list))
+	for _, u := range list {
+		objs = append(objs, u)
+	}
+	return objs, nil
+}
+
+func (k *dynamicKind) Fetch(namespace, name string) (object, error) {
+	u, err := k.client.Namespace(namespace).Get(name, metav1.GetOptions{})
+	if err != nil {
+		return nil, err
+	}
+	return u, nil
+}
+
+func (k *dynamicKind) Create(obj object) error {
+	_, err := k.client.Namespace(obj.GetNamespace()).Create(obj.(*unstructured.Unstructured), metav1.CreateOptions{})
+	return err
+}
+
+func (k *dynamicKind) Update(obj object) (object, error) {
+	u, err := k.client.Namespace(obj.GetNamespace()).Update(obj.(*unstructured.Unstructured), metav1.UpdateOptions{})
+	if err != nil {
+		return nil, err
+	}
+	return u, nil
+}
+
+func (k *dynamicKind) Delete(namespace, name string, options *metav1.DeleteOptions) error {
+	return k.client.Namespace(namespace).Delete(name, options)
+}
+
+// fields returns the synced fields of obj following the rule of the kind
+func (k *dynamicKind) fields(obj object) []string {
+	if len(k.rule.fields) > 0 {
+		return k.rule.fields
+	}
+	var fields []string
+	for f := range obj.(*unstructured.Unstructured).Object {
+		switch f {
+		case "apiVersion", "kind", "metadata", "status":
+		default:
+			fields = append(fields, f)
+		}
+	}
+	return fields
+}
+
+// content returns the synced fields of obj
+func (k *dynamicKind) content(obj object) map[string]interface{} {
+	u := obj.(*unstructured.Unstructured)
+	content := make(map[string]interface{})
+	for _, f := range k.fields(obj) {
+		if v, ok := u.Object[f]; ok {
+			content[f] = v
+		}
+	}
+	return content
+}
+
+func (k *dynamicKind) Desired(source object) object {
+	s := source.(*unstructured.Unstructured)
+	u := &unstructured.Unstructured{Object: map[string]interface{}{}}
+	u.SetAPIVersion(s.GetAPIVersion())
+	u.SetKind(s.GetKind())
+	u.SetName(s.GetName())
+	u.SetLabels(s.GetLabels())
+	for f, v := range k.content(source) {
+		u.Object[f] = runtime.DeepCopyJSONValue(v)
+	}
+	return u
+}
+
+func (k *dynamicKind) Equal(a, b object) bool {
+	return equality.Semantic.DeepEqual(k.content(a), k.content(b))
+}
+
+func (k *dynamicKind) Hash(obj object) string {
+	return contentHash(k.content(obj))
+}
+
+func (k *dynamicKind) NeedsRecreate(desired, actual object) bool {
+	d := desired.(*unstructured.Unstructured)
+	a := actual.(*unstructured.Unstructured)
+	for _, f := range k.rule.immutable {
+		if !equality.Semantic.DeepEqual(d.Object[f], a.Object[f]) {
+			return true
+		}
+	}
+	return false
+}
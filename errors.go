@@ -0,0 +1,42 @@
+package main
+
+import (
+	"strings"
+
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// namespaceTerminatingCause is set by newer API servers when content can't be created in a terminating namespace
+const namespaceTerminatingCause metav1.CauseType = "NamespaceTerminating"
+
+// isImmutableError tells if update was rejected because the target object or field can't be changed.
+// Used to detect targets marked with `immutable: true` as the vendored API types predate that field.
+func isImmutableError(err error) bool {
+	return errors.IsInvalid(err) && strings.Contains(err.Error(), "immutable")
+}
+
+// isTerminatingError tells if write was rejected because the namespace is being deleted
+func isTerminatingError(err error) bool {
+	if !errors.IsForbidden(err) {
+		return false
+	}
+	if status, ok := err.(errors.APIStatus); ok && status.Status().Details != nil {
+		for _, cause := range status.Status().Details.Causes {
+			if cause.Type == namespaceTerminatingCause {
+				return true
+			}
+		}
+	}
+	return strings.Contains(err.Error(), "because it is being terminated")
+}
+
+// isBlockedError tells if write was refused by RBAC or by a ResourceQuota of the target namespace
+func isBlockedError(err error) bool {
+	return errors.IsForbidden(err) && !isTerminatingError(err)
+}
+
+// isPermanentError tells if write was rejected in a way retrying can't fix, e.g. invalid or oversize object
+func isPermanentError(err error) bool {
+	return errors.IsInvalid(err) || errors.IsRequestEntityTooLargeError(err)
+}
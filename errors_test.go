@@ -0,0 +1,133 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	core "k8s.io/client-go/testing"
+)
+
+var secretResource = schema.GroupResource{Resource: "secrets"}
+
+// reject makes verb on Secrets in namespace ns fail with err
+func (f *fixture) reject(verb, ns string, err error) {
+	f.client.PrependReactor(verb, "secrets", func(action core.Action) (bool, runtime.Object, error) {
+		if action.GetNamespace() == ns {
+			return true, nil, err
+		}
+		return false, nil, nil
+	})
+}
+
+func terminatingError() error {
+	err := errors.NewForbidden(secretResource, "foo", fmt.Errorf("unable to create new content in namespace c because it is being terminated"))
+	err.ErrStatus.Details.Causes = []metav1.StatusCause{{Type: namespaceTerminatingCause}}
+	return err
+}
+
+func TestSyncErrorClasses(t *testing.T) {
+	cases := []struct {
+		name    string
+		err     error
+		retry   bool
+		blocked bool
+		failed  bool
+		event   string
+	}{
+		{
+			name:    "forbidden",
+			err:     errors.NewForbidden(secretResource, "foo", fmt.Errorf("exceeded quota")),
+			retry:   true,
+			blocked: true,
+			event:   "Blocked in namespace c",
+		},
+		{
+			name:   "invalid",
+			err:    errors.NewInvalid(schema.GroupKind{Kind: "Secret"}, "foo", field.ErrorList{field.Invalid(field.NewPath("data"), "", "too long")}),
+			failed: true,
+			event:  "Rejected in namespace c",
+		},
+		{
+			name: "namespace terminating",
+			err:  terminatingError(),
+		},
+		{
+			name:   "server error",
+			err:    errors.NewInternalError(fmt.Errorf("injected failure")),
+			retry:  true,
+			failed: true,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			source := newSource("a", "foo", "b,c", "v1", time.Hour)
+			f := newFixture(t, newNamespace("a"), newNamespace("b"), newNamespace("c"), source)
+			f.reject("create", "c", tc.err)
+
+			err := f.secrets().sync("a/foo", false)
+			if retry := err != nil; retry != tc.retry {
+				t.Errorf("sync returned %v, want retry %v", err, tc.retry)
+			}
+			if s := f.secret("b", "foo"); origin(s) != "a/foo" {
+				t.Errorf("copy in b not synced despite error in c")
+			}
+
+			status := f.status(source)
+			if _, blocked := status.Blocked["c"]; blocked != tc.blocked {
+				t.Errorf("status blocked %v, want blocked %v", status.Blocked, tc.blocked)
+			}
+			if _, failed := status.Failures["c"]; failed != tc.failed {
+				t.Errorf("status failures %v, want failed %v", status.Failures, tc.failed)
+			}
+			if !tc.blocked && !tc.failed && status.Targeted != 1 {
+				t.Errorf("skipped namespace still targeted, status %+v", status)
+			}
+			if tc.event != "" {
+				f.expectEvent(tc.event)
+			}
+		})
+	}
+}
+
+func TestSyncRetriesConflict(t *testing.T) {
+	source := newSource("a", "foo", "b", "v2", time.Hour)
+	f := newFixture(t, newNamespace("a"), newNamespace("b"), source)
+	outdated := f.copyOf(source, "b")
+	outdated.Data["key"] = []byte("v1")
+	f.add(outdated)
+
+	conflicts := 0
+	f.client.PrependReactor("update", "secrets", func(action core.Action) (bool, runtime.Object, error) {
+		if action.GetNamespace() == "b" && conflicts == 0 {
+			conflicts++
+			return true, nil, errors.NewConflict(secretResource, "foo", fmt.Errorf("object has been modified"))
+		}
+		return false, nil, nil
+	})
+
+	if err := f.secrets().sync("a/foo", false); err != nil {
+		t.Fatal(err)
+	}
+	if conflicts != 1 {
+		t.Fatalf("%d conflicts, want 1", conflicts)
+	}
+	refetched := false
+	for _, action := range f.client.Actions() {
+		if action.GetVerb() == "get" && action.GetNamespace() == "b" {
+			refetched = true
+		}
+	}
+	if !refetched {
+		t.Error("copy not read again after conflict")
+	}
+	if copy := f.secret("b", "foo"); string(copy.Data["key"]) != "v2" {
+		t.Errorf("copy not updated after conflict, has data %q", copy.Data["key"])
+	}
+}
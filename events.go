@@ -0,0 +1,50 @@
+package main
+
+import (
+	log "github.com/sirupsen/logrus"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/scheme"
+	typedcorev1 "k8s.io/client-go/kubernetes/typed/core/v1"
+	"k8s.io/client-go/tools/record"
+)
+
+const (
+	controllerAgentName string = "konfig-syncer"
+
+	// reasonCollision is used when another source with higher precedence owns the copy
+	reasonCollision string = "Collision"
+	// reasonNotOwned is used when target object exists but wasn't created by konfig-syncer
+	reasonNotOwned string = "NotOwned"
+	// reasonRecreated is used when a copy had to be deleted and created again as it couldn't be updated
+	reasonRecreated string = "Recreated"
+	// reasonOrphaned is used on copies released by the orphan deletion policy, or whose source is gone when garbage collection runs in dry run mode
+	reasonOrphaned string = "Orphaned"
+	// reasonDeletionBlocked is used when the mass deletion safeguard refuses to delete copies
+	reasonDeletionBlocked string = "DeletionBlocked"
+	// reasonSynced is used on sources when their copies were created or updated
+	reasonSynced string = "Synced"
+	// reasonUpdated is used on copies updated from their source
+	reasonUpdated string = "Updated"
+	// reasonDeleted is used on copies deleted as their source no longer syncs them
+	reasonDeleted string = "Deleted"
+	// reasonMarkedForDeletion is used on copies waiting for the deletion grace period to pass
+	reasonMarkedForDeletion string = "MarkedForDeletion"
+	// reasonCreateFailed, reasonUpdateFailed and reasonDeleteFailed are used when writing a copy fails
+	reasonCreateFailed string = "CreateFailed"
+	reasonUpdateFailed string = "UpdateFailed"
+	reasonDeleteFailed string = "DeleteFailed"
+	// reasonBlocked is used when RBAC or a ResourceQuota of the target namespace refuses the copy
+	reasonBlocked string = "Blocked"
+	// reasonInvalid is used when the API server rejects the copy as invalid, which retrying can't fix
+	reasonInvalid string = "Invalid"
+	// reasonRetriesExhausted is used on sources given up on after failing to sync for too many times
+	reasonRetriesExhausted string = "RetriesExhausted"
+)
+
+func newEventRecorder(kubeclientset kubernetes.Interface) record.EventRecorder {
+	eventBroadcaster := record.NewBroadcaster()
+	eventBroadcaster.StartLogging(log.Debugf)
+	eventBroadcaster.StartRecordingToSink(&typedcorev1.EventSinkImpl{Interface: kubeclientset.CoreV1().Events("")})
+	return eventBroadcaster.NewRecorder(scheme.Scheme, corev1.EventSource{Component: controllerAgentName})
+}
@@ -0,0 +1,32 @@
+package main
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// cleanupFinalizer is added to sources so their copies are deleted even if the source is deleted while controller is down
+const cleanupFinalizer string = syncAnnotation + "/cleanup"
+
+func hasFinalizer(o metav1.Object) bool {
+	for _, f := range o.GetFinalizers() {
+		if f == cleanupFinalizer {
+			return true
+		}
+	}
+	return false
+}
+
+func withoutFinalizer(finalizers []string) []string {
+	var result []string
+	for _, f := range finalizers {
+		if f != cleanupFinalizer {
+			result = append(result, f)
+		}
+	}
+	return result
+}
+
+// beingDeleted tells if the source is waiting for its copies to be cleaned up before deletion
+func beingDeleted(o metav1.Object) bool {
+	return o.GetDeletionTimestamp() != nil && hasFinalizer(o)
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	log "github.com/sirupsen/logrus"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// orphanReason tells why a synced copy no longer belongs to its source, empty if it still does
+func (c *Controller) orphanReason(copy metav1.Object, get sourceGetter) string {
+	m, ok := metadataFromAnnotations(copy.GetAnnotations())
+	if !ok {
+		return ""
+	}
+
+	source, err := get(m.Namespace, m.Name)
+	if err != nil {
+		if errors.IsNotFound(err) {
+			return "source no longer exists"
+		}
+		log.Error(err)
+		return ""
+	}
+	if m.UID != "" && m.UID != string(source.GetUID()) {
+		return "source was recreated with different UID"
+	}
+	if beingDeleted(source) {
+		//Finalizer takes care of the copies
+		return ""
+	}
+	if !isSource(source.GetAnnotations()) {
+		return "source no longer has sync annotation"
+	}
+
+	t, err := targetFromAnnotations(source.GetAnnotations())
+	if err != nil {
+		//Dont touch copies of sources with broken annotations
+		return ""
+	}
+	ns, err := c.namespacesLister.Get(copy.GetNamespace())
+	if err != nil {
+		return ""
+	}
+	if !c.namespaceTargeted(t, ns) {
+		return "namespace no longer targeted by source"
+	}
+	return ""
+}
+
+// collectGarbage removes synced copies whose source is gone or no longer targets their namespace,
+// following the deletion policy recorded on the copy. In dry run mode orphans are only reported.
+func (c *Controller) collectGarbage() {
+	log.Info("Collecting orphaned copies")
+
+	for _, r := range c.reconcilers {
+		r.collectGarbage()
+	}
+}
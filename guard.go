@@ -0,0 +1,54 @@
+package main
+
+import (
+	"fmt"
+
+	log "github.com/sirupsen/logrus"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+// confirmDeletionAnnotation set to "true" on a source or namespace allows deleting copies beyond the safeguard limits
+const confirmDeletionAnnotation string = syncAnnotation + "/confirm-deletion"
+
+// deletionGuard refuses to delete too many copies at once
+type deletionGuard struct {
+	// maxCount is the maximum number of copies deleted at once, 0 disables the check
+	maxCount int
+	// maxPercent is the maximum percentage of copies deleted at once, 0 disables the check
+	maxPercent int
+}
+
+// check returns error if deleting planned out of total copies exceeds the limits
+func (g deletionGuard) check(planned, total int) error {
+	if planned == 0 {
+		return nil
+	}
+	if g.maxCount > 0 && planned > g.maxCount {
+		return fmt.Errorf("refusing to delete %d copies, limit is %d", planned, g.maxCount)
+	}
+	if g.maxPercent > 0 && total > 0 && planned*100 > g.maxPercent*total {
+		return fmt.Errorf("refusing to delete %d of %d copies, limit is %d%%", planned, total, g.maxPercent)
+	}
+	return nil
+}
+
+func deletionConfirmed(annotations map[string]string) bool {
+	return annotations[confirmDeletionAnnotation] == "true"
+}
+
+// guardDeletion checks that deleting planned out of total copies of kind is allowed.
+// Blocked deletions are reported on owner, which can allow them with the confirmation annotation.
+func (c *Controller) guardDeletion(kind string, owner runtime.Object, planned, total int, confirmed bool) error {
+	err := c.deletionGuard.check(planned, total)
+	if err == nil || confirmed {
+		return nil
+	}
+
+	o, _ := meta.Accessor(owner)
+	log.WithFields(log.Fields{"kind": kind, "namespace": o.GetNamespace(), "name": o.GetName()}).Warn(err)
+	c.recorder.Eventf(owner, corev1.EventTypeWarning, reasonDeletionBlocked, "Deleting %s copies blocked: %s, add %s: \"true\" annotation to confirm", kind, err, confirmDeletionAnnotation)
+	deletionsBlocked.WithLabelValues(kind).Inc()
+	return err
+}
@@ -0,0 +1,44 @@
+package main
+
+import "testing"
+
+func TestDeletionGuardCheck(t *testing.T) {
+	tests := []struct {
+		name    string
+		guard   deletionGuard
+		planned int
+		total   int
+		wantErr bool
+	}{
+		{"nothing planned", deletionGuard{maxCount: 1, maxPercent: 1}, 0, 100, false},
+		{"checks disabled", deletionGuard{}, 100, 100, false},
+		{"at count limit", deletionGuard{maxCount: 50}, 50, 100, false},
+		{"over count limit", deletionGuard{maxCount: 50}, 51, 100, true},
+		{"at percent limit", deletionGuard{maxPercent: 10}, 10, 100, false},
+		{"over percent limit", deletionGuard{maxPercent: 10}, 11, 100, true},
+		{"percent of few copies", deletionGuard{maxPercent: 50}, 2, 3, true},
+		{"percent without copies", deletionGuard{maxPercent: 10}, 1, 0, false},
+		{"within count but over percent", deletionGuard{maxCount: 50, maxPercent: 10}, 20, 100, true},
+		{"within percent but over count", deletionGuard{maxCount: 10, maxPercent: 50}, 20, 100, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.guard.check(tt.planned, tt.total)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("check(%d, %d) = %v, want error %v", tt.planned, tt.total, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestDeletionConfirmed(t *testing.T) {
+	if deletionConfirmed(nil) {
+		t.Error("deletion confirmed without annotation")
+	}
+	if deletionConfirmed(map[string]string{confirmDeletionAnnotation: "yes"}) {
+		t.Error("deletion confirmed with value other than true")
+	}
+	if !deletionConfirmed(map[string]string{confirmDeletionAnnotation: "true"}) {
+		t.Error("deletion not confirmed with true")
+	}
+}
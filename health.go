@@ -0,0 +1,87 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// heartbeat tracks the items in flight in the workers of a single queue
+type heartbeat struct {
+	mu      sync.Mutex
+	next    int
+	started map[int]time.Time
+}
+
+func newHeartbeat() *heartbeat {
+	return &heartbeat{started: make(map[int]time.Time)}
+}
+
+// start is called when a worker picks up an item, the returned id is passed to finish
+func (h *heartbeat) start() int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.next++
+	h.started[h.next] = time.Now()
+	return h.next
+}
+
+// finish is called when a worker is done with the item
+func (h *heartbeat) finish(id int) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	delete(h.started, id)
+}
+
+// stalled tells how long the oldest item in flight has been worked on if it's longer than timeout, zero otherwise.
+// Every worker is checked on its own so other workers finishing items can't hide a stuck one.
+func (h *heartbeat) stalled(timeout time.Duration) time.Duration {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	var oldest time.Duration
+	for _, started := range h.started {
+		if since := time.Since(started); since > oldest {
+			oldest = since
+		}
+	}
+	if oldest > timeout {
+		return oldest
+	}
+	return 0
+}
+
+// synced tells if all the informer caches have synced
+func (c *Controller) synced() bool {
+	for _, r := range c.reconcilers {
+		if !r.kind.Synced() {
+			return false
+		}
+	}
+	return c.namespacesSynced()
+}
+
+// healthz fails when the workers of any queue are stuck, so the controller gets restarted
+func (c *Controller) healthz(w http.ResponseWriter, r *http.Request) {
+	for name, h := range c.heartbeats {
+		if stalled := h.stalled(c.workerTimeout); stalled > 0 {
+			http.Error(w, fmt.Sprintf("%s worker stuck on an item for %s", name, stalled.Round(time.Second)), http.StatusServiceUnavailable)
+			return
+		}
+	}
+	fmt.Fprintln(w, "ok")
+}
+
+// readyz fails until the informer caches have synced and reports whether this replica is leading.
+// Followers keep their caches warm so they are ready to take over.
+func (c *Controller) readyz(w http.ResponseWriter, r *http.Request) {
+	if !c.synced() {
+		http.Error(w, "informer caches not synced", http.StatusServiceUnavailable)
+		return
+	}
+	if c.leading() {
+		fmt.Fprintln(w, "ok: leading")
+		return
+	}
+	fmt.Fprintln(w, "ok: standing by")
+}
@@ -0,0 +1,38 @@
+package main
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+// object is a namespaced Kubernetes object of any kind
+type object interface {
+	metav1.Object
+	runtime.Object
+}
+
+// kindAdapter gives the reconciler access to objects of a single kind
+type kindAdapter interface {
+	// Kind is the name of the kind used in logs, events and metrics
+	Kind() string
+	// Synced tells if the informer cache of the kind has synced
+	Synced() bool
+
+	// Get and List read from the informer cache, List returns objects in all namespaces when namespace is empty
+	Get(namespace, name string) (object, error)
+	List(namespace string) ([]object, error)
+	// Fetch reads the object from the API server when the cache may not have caught up yet
+	Fetch(namespace, name string) (object, error)
+	Create(obj object) error
+	Update(obj object) (object, error)
+	Delete(namespace, name string, options *metav1.DeleteOptions) error
+
+	// Desired returns a new object with the name, labels and synced content of source
+	Desired(source object) object
+	// Equal tells if the synced content of a and b is equal, metadata is not compared
+	Equal(a, b object) bool
+	// Hash returns a short hash of the synced content
+	Hash(obj object) string
+	// NeedsRecreate tells if actual has content that can't be updated to desired
+	NeedsRecreate(desired, actual object) bool
+}
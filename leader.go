@@ -0,0 +1,185 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"sync/atomic"
+
+	log "github.com/sirupsen/logrus"
+	coordinationv1beta1 "k8s.io/api/coordination/v1beta1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	coordinationclient "k8s.io/client-go/kubernetes/typed/coordination/v1beta1"
+	"k8s.io/client-go/tools/leaderelection"
+	"k8s.io/client-go/tools/leaderelection/resourcelock"
+	"k8s.io/client-go/tools/record"
+)
+
+// leaseLock is a leader election lock backed by a coordination.k8s.io Lease,
+// client-go only ships ConfigMap and Endpoints based locks
+type leaseLock struct {
+	namespace string
+	name      string
+	client    coordinationclient.LeasesGetter
+	identity  string
+	recorder  record.EventRecorder
+	lease     *coordinationv1beta1.Lease
+}
+
+// Get returns the election record from the Lease spec
+func (l *leaseLock) Get() (*resourcelock.LeaderElectionRecord, error) {
+	var err error
+	l.lease, err = l.client.Leases(l.namespace).Get(l.name, metav1.GetOptions{})
+	if err != nil {
+		return nil, err
+	}
+	return leaseSpecToRecord(&l.lease.Spec), nil
+}
+
+// Create creates the Lease holding the election record
+func (l *leaseLock) Create(ler resourcelock.LeaderElectionRecord) error {
+	var err error
+	l.lease, err = l.client.Leases(l.namespace).Create(&coordinationv1beta1.Lease{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      l.name,
+			Namespace: l.namespace,
+		},
+		Spec: recordToLeaseSpec(&ler),
+	})
+	return err
+}
+
+// Update writes the election record to the existing Lease
+func (l *leaseLock) Update(ler resourcelock.LeaderElectionRecord) error {
+	if l.lease == nil {
+		return errors.New("lease not initialized, call get or create first")
+	}
+	l.lease.Spec = recordToLeaseSpec(&ler)
+	var err error
+	l.lease, err = l.client.Leases(l.namespace).Update(l.lease)
+	return err
+}
+
+// RecordEvent records leader election events on the Lease
+func (l *leaseLock) RecordEvent(s string) {
+	if l.lease == nil {
+		return
+	}
+	l.recorder.Eventf(&coordinationv1beta1.Lease{ObjectMeta: l.lease.ObjectMeta}, corev1.EventTypeNormal, "LeaderElection", "%v %v", l.identity, s)
+}
+
+// Describe returns the Lease key for logging
+func (l *leaseLock) Describe() string {
+	return fmt.Sprintf("%v/%v", l.namespace, l.name)
+}
+
+// Identity returns the identity of this candidate
+func (l *leaseLock) Identity() string {
+	return l.identity
+}
+
+func leaseSpecToRecord(spec *coordinationv1beta1.LeaseSpec) *resourcelock.LeaderElectionRecord {
+	r := &resourcelock.LeaderElectionRecord{}
+	if spec.HolderIdentity != nil {
+		r.HolderIdentity = *spec.HolderIdentity
+	}
+	if spec.LeaseDurationSeconds != nil {
+		r.LeaseDurationSeconds = int(*spec.LeaseDurationSeconds)
+	}
+	if spec.LeaseTransitions != nil {
+		r.LeaderTransitions = int(*spec.LeaseTransitions)
+	}
+	if spec.AcquireTime != nil {
+		r.AcquireTime = metav1.NewTime(spec.AcquireTime.Time)
+	}
+	if spec.RenewTime != nil {
+		r.RenewTime = metav1.NewTime(spec.RenewTime.Time)
+	}
+	return r
+}
+
+func recordToLeaseSpec(ler *resourcelock.LeaderElectionRecord) coordinationv1beta1.LeaseSpec {
+	leaseDurationSeconds := int32(ler.LeaseDurationSeconds)
+	leaseTransitions := int32(ler.LeaderTransitions)
+	return coordinationv1beta1.LeaseSpec{
+		HolderIdentity:       &ler.HolderIdentity,
+		LeaseDurationSeconds: &leaseDurationSeconds,
+		AcquireTime:          &metav1.MicroTime{Time: ler.AcquireTime.Time},
+		RenewTime:            &metav1.MicroTime{Time: ler.RenewTime.Time},
+		LeaseTransitions:     &leaseTransitions,
+	}
+}
+
+// leading tells if this replica is running the workers
+func (c *Controller) leading() bool {
+	return atomic.LoadInt32(&c.isLeader) == 1
+}
+
+func (c *Controller) setLeading(leading bool) {
+	var v int32
+	if leading {
+		v = 1
+	}
+	atomic.StoreInt32(&c.isLeader, v)
+	leader.Set(float64(v))
+}
+
+// runLeaderElected campaigns for the Lease and runs the workers while leading.
+// Losing the Lease is returned as an error so the process restarts instead of racing with the new leader.
+func (c *Controller) runLeaderElected(threadiness int, stopCh <-chan struct{}) error {
+	identity, err := os.Hostname()
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		select {
+		case <-stopCh:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	elector, err := leaderelection.NewLeaderElector(leaderelection.LeaderElectionConfig{
+		Lock: &leaseLock{
+			namespace: c.leaderElection.Namespace,
+			name:      c.leaderElection.Name,
+			client:    c.kubeclientset.CoordinationV1beta1(),
+			identity:  identity,
+			recorder:  c.recorder,
+		},
+		LeaseDuration: c.leaderElection.LeaseDuration,
+		RenewDeadline: c.leaderElection.RenewDeadline,
+		RetryPeriod:   c.leaderElection.RetryPeriod,
+		Callbacks: leaderelection.LeaderCallbacks{
+			OnStartedLeading: func(ctx context.Context) {
+				log.WithField("identity", identity).Info("Started leading")
+				c.runWorkers(threadiness, ctx.Done())
+			},
+			OnStoppedLeading: func() {
+				c.setLeading(false)
+				log.WithField("identity", identity).Info("Stopped leading")
+			},
+			OnNewLeader: func(holder string) {
+				log.WithField("leader", holder).Info("New leader elected")
+			},
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	log.WithFields(log.Fields{"identity": identity, "lease": c.leaderElection.Namespace + "/" + c.leaderElection.Name}).Info("Waiting for leadership")
+	elector.Run(ctx)
+
+	select {
+	case <-stopCh:
+		return nil
+	default:
+		return errors.New("leadership lost")
+	}
+}
@@ -2,20 +2,51 @@ package main
 
 import (
 	"flag"
+	"strings"
 	"time"
 
 	"github.com/n1koo/konfig-syncer/pkg/signals"
+	"github.com/prometheus/client_golang/prometheus"
 	log "github.com/sirupsen/logrus"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/dynamic/dynamicinformer"
 	kubeinformers "k8s.io/client-go/informers"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/tools/clientcmd"
 )
 
 var (
-	masterURL         string
-	kubeconfig        string
-	debug             bool
-	humanReadableLogs bool
+	masterURL                string
+	kubeconfig               string
+	debug                    bool
+	humanReadableLogs        bool
+	excludeNamespaces        string
+	excludeNamespaceSelector string
+	adoptionPolicy           string
+	labelAllowlist           string
+	labelDenylist            string
+	annotationAllowlist      string
+	annotationDenylist       string
+	gcInterval               time.Duration
+	gcDryRun                 bool
+	maxDeletions             int
+	maxDeletionPercent       int
+	deletionGracePeriod      time.Duration
+	listenAddress            string
+	workerTimeout            time.Duration
+	leaderElect              bool
+	leaseNamespace           string
+	leaseName                string
+	leaseDuration            time.Duration
+	renewDeadline            time.Duration
+	retryPeriod              time.Duration
+	resources                string
+	maxRetries               int
+	targetConcurrency        int
+	maxWritesPerSync         int
+	kubeAPIQPS               float64
+	kubeAPIBurst             int
 )
 
 func init() {
@@ -23,6 +54,32 @@ func init() {
 	flag.StringVar(&masterURL, "master", "", "The address of the Kubernetes API server. Overrides any value in kubeconfig. Only required if out-of-cluster.")
 	flag.BoolVar(&debug, "debug", false, "Enable debug mode")
 	flag.BoolVar(&humanReadableLogs, "human-readable-logs", false, "Log in human readable mode rather than default json")
+	flag.StringVar(&excludeNamespaces, "exclude-namespaces", "kube-system,kube-public,kube-node-lease", "Comma separated list of namespaces that never receive synced objects")
+	flag.StringVar(&excludeNamespaceSelector, "exclude-namespace-selector", "", "Label selector for namespaces that never receive synced objects")
+	flag.StringVar(&adoptionPolicy, "adoption-policy", adoptNever, "What to do with existing objects not created by konfig-syncer: never, if-identical or always")
+	flag.StringVar(&labelAllowlist, "label-allowlist", "", "Comma separated list of label keys copied to synced objects, supports trailing * wildcard. Empty allows all")
+	flag.StringVar(&labelDenylist, "label-denylist", defaultLabelDenylist, "Comma separated list of label keys never copied to synced objects, supports trailing * wildcard")
+	flag.StringVar(&annotationAllowlist, "annotation-allowlist", "", "Comma separated list of annotation keys copied to synced objects, supports trailing * wildcard. Empty allows all")
+	flag.StringVar(&annotationDenylist, "annotation-denylist", defaultAnnotationDenylist, "Comma separated list of annotation keys never copied to synced objects, supports trailing * wildcard")
+	flag.DurationVar(&gcInterval, "gc-interval", 10*time.Minute, "How often orphaned copies are garbage collected, 0 disables garbage collection")
+	flag.BoolVar(&gcDryRun, "gc-dry-run", false, "Only report orphaned copies instead of deleting them")
+	flag.IntVar(&maxDeletions, "max-deletions", 50, "Maximum number of copies deleted at once without confirmation annotation, 0 disables the check")
+	flag.IntVar(&maxDeletionPercent, "max-deletion-percent", 0, "Maximum percentage of copies deleted at once without confirmation annotation, 0 disables the check")
+	flag.DurationVar(&deletionGracePeriod, "deletion-grace-period", 0, "How long copies are kept marked for deletion before they are deleted, 0 deletes immediately")
+	flag.StringVar(&listenAddress, "listen-address", ":8080", "Address the /metrics, /healthz and /readyz endpoints are served on, empty disables them")
+	flag.DurationVar(&workerTimeout, "worker-timeout", 5*time.Minute, "How long workers can be busy without progress before /healthz fails")
+	flag.BoolVar(&leaderElect, "leader-elect", false, "Elect a leader using a Lease so multiple replicas can be run, only the leader syncs")
+	flag.StringVar(&leaseNamespace, "leader-elect-resource-namespace", "kube-system", "Namespace of the Lease used for leader election")
+	flag.StringVar(&leaseName, "leader-elect-resource-name", "konfig-syncer", "Name of the Lease used for leader election")
+	flag.DurationVar(&leaseDuration, "leader-elect-lease-duration", 15*time.Second, "How long followers wait before trying to take over a Lease that isn't renewed")
+	flag.DurationVar(&renewDeadline, "leader-elect-renew-deadline", 10*time.Second, "How long the leader keeps trying to renew the Lease before giving up leadership")
+	flag.DurationVar(&retryPeriod, "leader-elect-retry-period", 2*time.Second, "How often acquiring or renewing the Lease is tried")
+	flag.StringVar(&resources, "resources", "", "Comma separated list of namespaced group/version/resource synced in addition to Secrets and ConfigMaps, e.g. rbac.authorization.k8s.io/v1/roles,v1/limitranges. Synced fields can be overridden with :field+field")
+	flag.IntVar(&maxRetries, "max-retries", 15, "How many times failing syncs are retried with backoff before giving up until the source changes, 0 retries forever")
+	flag.IntVar(&targetConcurrency, "target-concurrency", 10, "How many copies are written to the API server concurrently across all workers")
+	flag.IntVar(&maxWritesPerSync, "max-writes-per-sync", 100, "How many copies a single sync of a source writes before requeueing it to continue later, 0 is unlimited")
+	flag.Float64Var(&kubeAPIQPS, "kube-api-qps", 20, "Maximum queries per second to the Kubernetes API server")
+	flag.IntVar(&kubeAPIBurst, "kube-api-burst", 30, "Maximum burst of queries to the Kubernetes API server")
 	flag.Set("logtostderr", "true")
 }
 
@@ -43,23 +100,98 @@ func main() {
 	if err != nil {
 		log.Fatalf("Error building kubeconfig: %s", err.Error())
 	}
+	cfg.QPS = float32(kubeAPIQPS)
+	cfg.Burst = kubeAPIBurst
 
 	kubeClient, err := kubernetes.NewForConfig(cfg)
 	if err != nil {
 		log.Fatalf("Error building kubernetes clientset: %s", err.Error())
 	}
 
+	dynamicClient, err := dynamic.NewForConfig(cfg)
+	if err != nil {
+		log.Fatalf("Error building dynamic client: %s", err.Error())
+	}
+
+	syncedResources, err := parseResources(resources)
+	if err != nil {
+		log.Fatalf("Error parsing resources: %s", err.Error())
+	}
+	if err = resolveResources(kubeClient.Discovery(), syncedResources); err != nil {
+		log.Fatalf("Error resolving resources: %s", err.Error())
+	}
+
+	excludeSelector, err := labels.Parse(excludeNamespaceSelector)
+	if err != nil {
+		log.Fatalf("Error parsing exclude namespace selector: %s", err.Error())
+	}
+
+	if err = validAdoptionPolicy(adoptionPolicy); err != nil {
+		log.Fatalf("Error parsing adoption policy: %s", err.Error())
+	}
+
+	var leaderElection *LeaderElection
+	if leaderElect {
+		leaderElection = &LeaderElection{
+			Namespace:     leaseNamespace,
+			Name:          leaseName,
+			LeaseDuration: leaseDuration,
+			RenewDeadline: renewDeadline,
+			RetryPeriod:   retryPeriod,
+		}
+	}
+
 	kubeInformerFactory := kubeinformers.NewSharedInformerFactory(kubeClient, time.Minute*1)
+	dynamicInformerFactory := dynamicinformer.NewDynamicSharedInformerFactory(dynamicClient, time.Minute*1)
 
 	c := NewController(kubeClient,
 		kubeInformerFactory.Core().V1().ConfigMaps(),
 		kubeInformerFactory.Core().V1().Secrets(),
 		kubeInformerFactory.Core().V1().Namespaces(),
+		dynamicClient,
+		dynamicInformerFactory,
+		Options{
+			ExcludeNamespaces:        splitList(excludeNamespaces),
+			ExcludeNamespaceSelector: excludeSelector,
+			AdoptionPolicy:           adoptionPolicy,
+			LabelAllowlist:           splitList(labelAllowlist),
+			LabelDenylist:            splitList(labelDenylist),
+			AnnotationAllowlist:      splitList(annotationAllowlist),
+			AnnotationDenylist:       splitList(annotationDenylist),
+			GCInterval:               gcInterval,
+			GCDryRun:                 gcDryRun,
+			MaxDeletions:             maxDeletions,
+			MaxDeletionPercent:       maxDeletionPercent,
+			DeletionGracePeriod:      deletionGracePeriod,
+			WorkerTimeout:            workerTimeout,
+			LeaderElection:           leaderElection,
+			Resources:                syncedResources,
+			MaxRetries:               maxRetries,
+			TargetConcurrency:        targetConcurrency,
+			MaxWritesPerSync:         maxWritesPerSync,
+		},
 	)
 
+	if listenAddress != "" {
+		prometheus.MustRegister(newManagedCopiesCollector(c))
+		go serve(listenAddress, newServeMux(c))
+	}
+
 	kubeInformerFactory.Start(stopCh)
+	dynamicInformerFactory.Start(stopCh)
 
 	if err = c.Run(2, stopCh); err != nil {
 		log.Fatalf("Error running controller: %s", err.Error())
 	}
 }
+
+// splitList splits comma separated flag value dropping empty entries
+func splitList(value string) []string {
+	var list []string
+	for _, v := range strings.Split(value, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			list = append(list, v)
+		}
+	}
+	return list
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"k8s.io/client-go/util/workqueue"
+)
+
+const metricsNamespace string = "konfig_syncer"
+
+var (
+	deletionsBlocked = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "deletions_blocked_total",
+		Help:      "Number of times deleting copies was blocked by the mass deletion safeguard.",
+	}, []string{"kind"})
+
+	operations = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "operations_total",
+		Help:      "Number of creates, updates and deletes of copies by kind and outcome.",
+	}, []string{"kind", "operation", "outcome"})
+
+	syncDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: metricsNamespace,
+		Name:      "sync_duration_seconds",
+		Help:      "Time spent syncing a single workqueue item.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"handler"})
+
+	deadLetters = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "dead_letters_total",
+		Help:      "Number of items given up on after using up their retries.",
+	}, []string{"kind"})
+
+	leader = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Name:      "leader",
+		Help:      "Whether this replica is the leader running the workers.",
+	})
+
+	managedCopiesDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(metricsNamespace, "", "managed_copies"),
+		"Number of copies managed per source.",
+		[]string{"kind", "namespace", "name"}, nil)
+)
+
+func init() {
+	prometheus.MustRegister(deletionsBlocked, operations, syncDuration, deadLetters, leader)
+	prometheus.MustRegister(workqueueDepth, workqueueAdds, workqueueLatency, workqueueWorkDuration,
+		workqueueUnfinishedWork, workqueueLongestRunning, workqueueRetries)
+	// Has to be set before the queues are created
+	workqueue.SetProvider(workqueueMetricsProvider{})
+}
+
+// countOperation records the outcome of a write to a copy
+func countOperation(kind, operation string, err error) {
+	outcome := "success"
+	if err != nil {
+		outcome = "error"
+	}
+	operations.WithLabelValues(kind, operation, outcome).Inc()
+}
+
+type copyOrigin struct {
+	namespace, name string
+}
+
+// managedCopiesCollector counts the copies per source from the informer caches on every scrape,
+// so sources that are gone don't leave stale series behind
+type managedCopiesCollector struct {
+	controller *Controller
+}
+
+func newManagedCopiesCollector(c *Controller) prometheus.Collector {
+	return managedCopiesCollector{controller: c}
+}
+
+func (m managedCopiesCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- managedCopiesDesc
+}
+
+func (m managedCopiesCollector) Collect(ch chan<- prometheus.Metric) {
+	for _, r := range m.controller.reconcilers {
+		if counts := r.managedCopies(); counts != nil {
+			collectCopies(ch, r.kind.Kind(), counts)
+		}
+	}
+}
+
+func collectCopies(ch chan<- prometheus.Metric, kind string, counts map[copyOrigin]int) {
+	for source, n := range counts {
+		ch <- prometheus.MustNewConstMetric(managedCopiesDesc, prometheus.GaugeValue, float64(n), kind, source.namespace, source.name)
+	}
+}
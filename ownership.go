@@ -0,0 +1,55 @@
+package main
+
+import (
+	"fmt"
+
+	log "github.com/sirupsen/logrus"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	adoptAnnotation string = syncAnnotation + "/adopt"
+
+	// adoptNever leaves objects not created by konfig-syncer untouched
+	adoptNever string = "never"
+	// adoptIfIdentical takes over objects whose content already equals the source
+	adoptIfIdentical string = "if-identical"
+	// adoptAlways overwrites objects not created by konfig-syncer
+	adoptAlways string = "always"
+)
+
+func validAdoptionPolicy(policy string) error {
+	switch policy {
+	case adoptNever, adoptIfIdentical, adoptAlways:
+		return nil
+	}
+	return fmt.Errorf("%q not valid adoption policy, must be one of %s, %s or %s", policy, adoptNever, adoptIfIdentical, adoptAlways)
+}
+
+// adoptionPolicy returns the adoption policy of source, falling back to controller default
+func (c *Controller) adoptionPolicy(source metav1.Object) string {
+	policy, ok := source.GetAnnotations()[adoptAnnotation]
+	if !ok {
+		return c.defaultAdoptionPolicy
+	}
+	if err := validAdoptionPolicy(policy); err != nil {
+		log.WithFields(log.Fields{"namespace": source.GetNamespace(), "name": source.GetName()}).Warn(err)
+		return c.defaultAdoptionPolicy
+	}
+	return policy
+}
+
+// canAdopt tells if an existing object that isn't managed by konfig-syncer may be overwritten by source.
+// Objects that are sources themselves, or still being cleaned up as one, are never adopted.
+func (c *Controller) canAdopt(source, existing metav1.Object, identical bool) bool {
+	if isSource(existing.GetAnnotations()) || hasFinalizer(existing) {
+		return false
+	}
+	switch c.adoptionPolicy(source) {
+	case adoptAlways:
+		return true
+	case adoptIfIdentical:
+		return identical
+	}
+	return false
+}
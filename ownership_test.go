@@ -0,0 +1,69 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestSyncAdoption(t *testing.T) {
+	existing := func(data string, modify func(*corev1.Secret)) *corev1.Secret {
+		s := &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "b", Name: "foo", ResourceVersion: "1"},
+			Data:       map[string][]byte{"key": []byte(data)},
+		}
+		if modify != nil {
+			modify(s)
+		}
+		return s
+	}
+
+	cases := []struct {
+		name     string
+		policy   string
+		existing *corev1.Secret
+		adopted  bool
+	}{
+		{"never", adoptNever, existing("v1", nil), false},
+		{"if-identical with same content", adoptIfIdentical, existing("v1", nil), true},
+		{"if-identical with other content", adoptIfIdentical, existing("other", nil), false},
+		{"always", adoptAlways, existing("other", nil), true},
+		{"always but a source itself", adoptAlways, existing("other", func(s *corev1.Secret) {
+			s.Annotations = map[string]string{namespacesAnnotation: "c"}
+		}), false},
+		{"always but still cleaned up as a source", adoptAlways, existing("other", func(s *corev1.Secret) {
+			s.Finalizers = []string{cleanupFinalizer}
+		}), false},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			source := newSource("a", "foo", "b", "v1", time.Hour)
+			source.Annotations[adoptAnnotation] = tc.policy
+			f := newFixture(t, newNamespace("a"), newNamespace("b"), source, tc.existing)
+
+			if err := f.secrets().sync("a/foo", false); err != nil {
+				t.Fatal(err)
+			}
+			copy := f.secret("b", "foo")
+			if adopted := origin(copy) == "a/foo"; adopted != tc.adopted {
+				t.Fatalf("adopted %v, want %v", adopted, tc.adopted)
+			}
+			if tc.adopted {
+				if string(copy.Data["key"]) != "v1" {
+					t.Errorf("adopted copy has data %q", copy.Data["key"])
+				}
+				return
+			}
+			if string(copy.Data["key"]) != string(tc.existing.Data["key"]) {
+				t.Errorf("object not adopted but overwritten with %q", copy.Data["key"])
+			}
+			if s := f.status(source); s.Failures["b"] == "" {
+				t.Errorf("status failures %v, want failure in b", s.Failures)
+			}
+			f.expectEvent("isn't managed by konfig-syncer")
+		})
+	}
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+// parallelize calls fn for every index below n. The calls share a controller wide pool of
+// -target-concurrency slots, so the number of concurrent writes stays bounded across all workers.
+func (c *Controller) parallelize(n int, fn func(i int)) {
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		c.writeSlots <- struct{}{}
+		wg.Add(1)
+		go func(i int) {
+			defer func() {
+				<-c.writeSlots
+				wg.Done()
+			}()
+			fn(i)
+		}(i)
+	}
+	wg.Wait()
+}
+
+// writeBudget limits the number of copies written for a source in a single sync,
+// so a huge fan-out continues on a later pass instead of holding a worker
+type writeBudget struct {
+	limited bool
+	left    int64
+}
+
+// newWriteBudget creates budget of max writes, 0 is unlimited
+func newWriteBudget(max int) *writeBudget {
+	return &writeBudget{limited: max > 0, left: int64(max)}
+}
+
+// take tells if there is budget left for one more write
+func (b *writeBudget) take() bool {
+	return !b.limited || atomic.AddInt64(&b.left, -1) >= 0
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"strings"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	labelAllowlistAnnotation      string = syncAnnotation + "/label-allowlist"
+	labelDenylistAnnotation       string = syncAnnotation + "/label-denylist"
+	annotationAllowlistAnnotation string = syncAnnotation + "/annotation-allowlist"
+	annotationDenylistAnnotation  string = syncAnnotation + "/annotation-denylist"
+
+	// defaultLabelDenylist strips labels used by Helm and ArgoCD for tracking the resources they manage
+	defaultLabelDenylist string = "app.kubernetes.io/managed-by,app.kubernetes.io/instance,helm.sh/chart,argocd.argoproj.io/*"
+	// defaultAnnotationDenylist strips kubectl apply state (which contains plaintext data of Secrets) and Helm/ArgoCD tracking annotations
+	defaultAnnotationDenylist string = "kubectl.kubernetes.io/last-applied-configuration,meta.helm.sh/*,helm.sh/*,argocd.argoproj.io/*"
+)
+
+// keyFilter decides which label or annotation keys are copied from the source.
+// Patterns match keys exactly or by prefix when ending with `*`.
+type keyFilter struct {
+	allow []string
+	deny  []string
+}
+
+func matchesKey(patterns []string, key string) bool {
+	for _, p := range patterns {
+		if strings.HasSuffix(p, "*") {
+			if strings.HasPrefix(key, strings.TrimSuffix(p, "*")) {
+				return true
+			}
+		} else if p == key {
+			return true
+		}
+	}
+	return false
+}
+
+// allowed tells if key is copied. Empty allowlist allows everything that isn't denied.
+func (f keyFilter) allowed(key string) bool {
+	if len(f.allow) > 0 && !matchesKey(f.allow, key) {
+		return false
+	}
+	return !matchesKey(f.deny, key)
+}
+
+func (f keyFilter) filter(m map[string]string) map[string]string {
+	if m == nil {
+		return nil
+	}
+	filtered := make(map[string]string, len(m))
+	for k, v := range m {
+		if f.allowed(k) {
+			filtered[k] = v
+		}
+	}
+	return filtered
+}
+
+// newKeyFilter builds filter from controller defaults, the per source annotations replace them when set
+func newKeyFilter(source metav1.Object, allow, deny []string, allowAnnotation, denyAnnotation string) keyFilter {
+	f := keyFilter{allow: allow, deny: deny}
+	if v, ok := source.GetAnnotations()[allowAnnotation]; ok {
+		f.allow = splitList(v)
+	}
+	if v, ok := source.GetAnnotations()[denyAnnotation]; ok {
+		f.deny = splitList(v)
+	}
+	return f
+}
+
+// propagateMetadata filters labels and annotations of a new copy according to the propagation policy of source
+func (c *Controller) propagateMetadata(source metav1.Object, copy metav1.Object) {
+	labelFilter := newKeyFilter(source, c.labelAllowlist, c.labelDenylist, labelAllowlistAnnotation, labelDenylistAnnotation)
+	annotationFilter := newKeyFilter(source, c.annotationAllowlist, c.annotationDenylist, annotationAllowlistAnnotation, annotationDenylistAnnotation)
+
+	copy.SetLabels(labelFilter.filter(copy.GetLabels()))
+	copy.SetAnnotations(annotationFilter.filter(copy.GetAnnotations()))
+}
@@ -0,0 +1,1027 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/util/retry"
+	"k8s.io/client-go/util/workqueue"
+)
+
+// reconciler syncs sources of a single kind to the namespaces they target
+type reconciler struct {
+	c       *Controller
+	kind    kindAdapter
+	name    string
+	queue   workqueue.RateLimitingInterface
+	deleted cache.Indexer
+	failed  *failedTargets
+}
+
+// newReconciler creates reconciler for kind, name is used for its workqueue
+func newReconciler(c *Controller, kind kindAdapter, name string) *reconciler {
+	return &reconciler{
+		c:       c,
+		kind:    kind,
+		name:    name,
+		queue:   workqueue.NewNamedRateLimitingQueue(workqueue.DefaultControllerRateLimiter(), name),
+		deleted: cache.NewIndexer(cache.DeletionHandlingMetaNamespaceKeyFunc, cache.Indexers{}),
+		failed:  newFailedTargets(),
+	}
+}
+
+func (r *reconciler) fields(o metav1.Object) log.Fields {
+	return log.Fields{"kind": r.kind.Kind(), "name": o.GetName(), "namespace": o.GetNamespace()}
+}
+
+func (r *reconciler) enqueue(obj interface{}) {
+	key, err := cache.DeletionHandlingMetaNamespaceKeyFunc(obj)
+	if err != nil {
+		utilruntime.HandleError(err)
+		return
+	}
+	r.enqueueKey(key)
+}
+
+// enqueueKey queues source for syncing to every targeted namespace.
+// Only failures are rate limited, so events dont count as retries.
+func (r *reconciler) enqueueKey(key string) {
+	r.failed.forget(key)
+	r.queue.Add(key)
+}
+
+// changed tells if anything that is synced has changed between two versions of a source
+func (r *reconciler) changed(old, new object) bool {
+	return !r.kind.Equal(old, new) ||
+		!stringMapsEqual(old.GetLabels(), new.GetLabels()) ||
+		!sourceAnnotationsEqual(old.GetAnnotations(), new.GetAnnotations())
+}
+
+// handlers returns the informer event handlers enqueueing sources of the kind
+func (r *reconciler) handlers() cache.ResourceEventHandlerFuncs {
+	return cache.ResourceEventHandlerFuncs{
+		AddFunc: func(obj interface{}) {
+			o, ok := obj.(object)
+			if !ok {
+				return
+			}
+			if isSource(o.GetAnnotations()) || hasFinalizer(o) {
+				log.WithFields(r.fields(o)).Debug("Source added to workqueue")
+				r.enqueue(o)
+			}
+		},
+		UpdateFunc: func(oldObj, newObj interface{}) {
+			old, ok := oldObj.(object)
+			if !ok {
+				return
+			}
+			new, ok := newObj.(object)
+			if !ok {
+				return
+			}
+
+			if key, ok := driftedOriginKey(new); ok {
+				if new.GetResourceVersion() != old.GetResourceVersion() {
+					log.WithFields(r.fields(new)).Debug("Synced copy changed, resync its source")
+					r.enqueueKey(key)
+				}
+				return
+			}
+
+			if beingDeleted(new) {
+				log.WithFields(r.fields(new)).Debug("Source is being deleted, cleanup its copies")
+				r.enqueue(new)
+				return
+			}
+
+			newHasAnno := isSource(new.GetAnnotations())
+			oldHasAnno := isSource(old.GetAnnotations())
+
+			if newHasAnno && !oldHasAnno {
+				log.WithFields(r.fields(new)).Debug("Updated to have sync annotation")
+				r.enqueue(new)
+			} else if !newHasAnno && oldHasAnno {
+				log.WithFields(r.fields(new)).Debug("Sync annotation was removed")
+				r.deleted.Add(old)
+				r.enqueue(new)
+			} else if targetChanged(old.GetAnnotations(), new.GetAnnotations()) {
+				log.WithFields(r.fields(new)).Debug("Sync annotation was changed")
+				r.deleted.Add(old)
+				r.enqueue(new)
+			} else if newHasAnno && r.changed(old, new) {
+				log.WithFields(r.fields(new)).Debug("Source content or metadata changed")
+				r.enqueue(new)
+			} else if !newHasAnno && hasFinalizer(new) {
+				log.WithFields(r.fields(new)).Debug("Object without sync annotation still has finalizer")
+				r.enqueue(new)
+			}
+		},
+		DeleteFunc: func(obj interface{}) {
+			o, ok := unwrapTombstone(obj).(object)
+			if !ok {
+				return
+			}
+			if key, ok := driftedOriginKey(o); ok {
+				log.WithFields(r.fields(o)).Debug("Synced copy deleted, resync its source")
+				r.enqueueKey(key)
+			} else if isSource(o.GetAnnotations()) {
+				log.WithFields(r.fields(o)).Debug("Source deleted")
+				r.enqueue(o)
+				r.deleted.Add(o)
+			}
+		},
+	}
+}
+
+func (r *reconciler) runWorker() {
+	for r.processNextItem() {
+	}
+}
+
+func (r *reconciler) processNextItem() bool {
+	obj, shutdown := r.queue.Get()
+
+	if shutdown {
+		return false
+	}
+
+	err := func(obj interface{}) error {
+		defer r.queue.Done(obj)
+		hb := r.c.heartbeats[r.name]
+		defer hb.finish(hb.start())
+		var key string
+		var ok bool
+
+		if key, ok = obj.(string); !ok {
+			r.queue.Forget(obj)
+			utilruntime.HandleError(fmt.Errorf("expected string in workqueue but got %#v", obj))
+			return nil
+		}
+
+		start := time.Now()
+		lastAttempt := r.c.retriesExhausted(r.queue.NumRequeues(key))
+		r.failed.clearPending(key)
+		err := r.sync(key, lastAttempt)
+		syncDuration.WithLabelValues("sync" + r.kind.Kind()).Observe(time.Since(start).Seconds())
+		if r.failed.hasPending(key) {
+			//Requeue at the back so other sources get their turn before continuing. Passes of a large fan-out
+			//dont count as retries, failures are retried with backoff once every namespace has been visited.
+			r.queue.Add(key)
+			if err != nil {
+				return fmt.Errorf("error syncing '%s': %s, continuing with pending namespaces", key, err.Error())
+			}
+			return nil
+		}
+		if err != nil && lastAttempt {
+			r.queue.Forget(obj)
+			r.failed.forget(key)
+			deadLetters.WithLabelValues(r.kind.Kind()).Inc()
+			return fmt.Errorf("error syncing '%s': %s, giving up after %d retries", key, err.Error(), r.c.maxRetries)
+		}
+		if err != nil {
+			r.queue.AddRateLimited(key)
+			return fmt.Errorf("error syncing '%s': %s, requeuing", key, err.Error())
+		}
+
+		r.queue.Forget(obj)
+		return nil
+	}(obj)
+
+	if err != nil {
+		utilruntime.HandleError(err)
+		return true
+	}
+
+	return true
+}
+
+func (r *reconciler) get(namespace, name string) (metav1.Object, error) {
+	return r.kind.Get(namespace, name)
+}
+
+// inNamespace returns copy of obj placed in namespace ns
+func inNamespace(obj object, ns string) object {
+	o := obj.DeepCopyObject().(object)
+	o.SetNamespace(ns)
+	return o
+}
+
+// desired returns the copy of source that is synced to other namespaces, without namespace set
+func (r *reconciler) desired(source object) object {
+	d := r.kind.Desired(source)
+	d.SetNamespace("")
+	d.SetResourceVersion("")
+	d.SetUID("")
+	d.SetGenerateName("")
+	d.SetSelfLink("")
+	d.SetCreationTimestamp(metav1.Time{})
+	d.SetFinalizers(nil)
+	d.SetOwnerReferences(nil)
+
+	annotations := make(map[string]string, len(source.GetAnnotations())+2)
+	for k, v := range source.GetAnnotations() {
+		annotations[k] = v
+	}
+	stripSourceAnnotations(annotations)
+	d.SetAnnotations(annotations)
+	r.c.propagateMetadata(source, d)
+
+	annotations = d.GetAnnotations()
+	if annotations == nil {
+		annotations = make(map[string]string)
+	}
+	hash := r.kind.Hash(source)
+	annotations[metadataAnnotation] = newSyncMetadata(source, syncedVersion(source, hash), time.Now().String())
+	if isVersioned(source) {
+		annotations[currentVersionAnnotation] = versionedName(d.GetName(), hash)
+	}
+	d.SetAnnotations(annotations)
+	return d
+}
+
+// upToDate tells if actual copy matches desired
+func (r *reconciler) upToDate(desired, actual object) bool {
+	return r.kind.Equal(desired, actual) &&
+		stringMapsEqual(desired.GetLabels(), actual.GetLabels()) &&
+		copyAnnotationsEqual(desired.GetAnnotations(), actual.GetAnnotations())
+}
+
+// sync syncs source key to the namespaces it targets. While an unchanged source is retried only the namespaces that
+// failed are synced again, on the last attempt the source is marked as dead-letter in its status.
+func (r *reconciler) sync(key string, lastAttempt bool) error {
+	namespace, name, err := cache.SplitMetaNamespaceKey(key)
+	if err != nil {
+		utilruntime.HandleError(fmt.Errorf("invalid resource key: %s", key))
+		return nil
+	}
+
+	source, err := r.kind.Get(namespace, name)
+	if err != nil {
+		if !errors.IsNotFound(err) {
+			return err
+		}
+		source = nil
+	}
+
+	obj, exists, _ := r.deleted.GetByKey(key)
+	if exists {
+		//Copies in namespaces the source still targets are kept, the rest get pruned after sync
+		if source == nil || !isSource(source.GetAnnotations()) {
+			old := obj.(object)
+			log.WithFields(r.fields(old)).Debug("Cleanup copies that were added by old source")
+			confirmed := deletionConfirmed(old.GetAnnotations()) || (source != nil && deletionConfirmed(source.GetAnnotations()))
+			if err := r.deleteSynced(old, nil, confirmed); err != nil {
+				return err
+			}
+		}
+		if source == nil && r.awaitingDeletion(obj.(object)) {
+			//Keep the old source until the grace period of its copies has passed and they are deleted
+			log.WithFields(r.fields(obj.(object))).Debug("Copies of old source are marked for deletion, revisit after grace period")
+		} else {
+			r.deleted.Delete(obj)
+		}
+	}
+
+	if source == nil {
+		return nil
+	}
+
+	if source.GetDeletionTimestamp() != nil || !isSource(source.GetAnnotations()) {
+		if !hasFinalizer(source) {
+			return nil
+		}
+		log.WithFields(r.fields(source)).Debug("Cleanup copies before removing finalizer")
+		if err := r.deleteSynced(source, nil, deletionConfirmed(source.GetAnnotations())); err != nil {
+			return err
+		}
+		if r.awaitingDeletion(source) {
+			//Keep the finalizer until the grace period has passed and the marked copies are deleted
+			log.WithFields(r.fields(source)).Debug("Copies are marked for deletion, keep finalizer until they are deleted")
+			r.queue.AddAfter(key, r.c.deletionGracePeriod)
+			return nil
+		}
+		_, err = r.update(source, func(s object) object {
+			s.SetFinalizers(withoutFinalizer(s.GetFinalizers()))
+			annotations := s.GetAnnotations()
+			delete(annotations, statusAnnotation)
+			s.SetAnnotations(annotations)
+			return s
+		})
+		return err
+	}
+
+	if !hasFinalizer(source) {
+		source, err = r.update(source, func(s object) object {
+			if !hasFinalizer(s) {
+				s.SetFinalizers(append(s.GetFinalizers(), cleanupFinalizer))
+			}
+			return s
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	t, err := targetFromAnnotations(source.GetAnnotations())
+	if err != nil {
+		log.WithFields(r.fields(source)).Warn(err)
+		return nil
+	}
+
+	namespaces, err := r.c.namespacesForTarget(t)
+	if err != nil {
+		return err
+	}
+
+	kind := r.kind.Kind()
+	newObj := r.desired(source)
+	status := newSyncStatus(source, r.kind.Hash(source), namespaces.Difference(sets.NewString(source.GetNamespace())).Len())
+	retry := r.failed.get(key, status.Hash)
+	var mu sync.Mutex
+	var errs []error
+	fail := func(ns, action, reason string, err error) {
+		if err := r.targetFailed(source, status, ns, action, reason, err); err != nil {
+			mu.Lock()
+			errs = append(errs, err)
+			mu.Unlock()
+		}
+	}
+
+	var visit []string
+	synced, changed := 0, 0
+	for _, ns := range namespaces.UnsortedList() {
+		if ns == source.GetNamespace() {
+			continue
+		}
+		if retry != nil && !retry.Has(ns) {
+			//Synced on the previous attempt
+			synced++
+			continue
+		}
+		visit = append(visit, ns)
+	}
+
+	//Copies are written through the controller wide pool, at most -max-writes-per-sync of them per pass
+	budget := newWriteBudget(r.c.maxWritesPerSync)
+	pending := sets.NewString()
+	deferTarget := func(ns string) {
+		mu.Lock()
+		pending.Insert(ns)
+		mu.Unlock()
+	}
+	count := func(written bool) {
+		mu.Lock()
+		defer mu.Unlock()
+		synced++
+		if written {
+			changed++
+		}
+	}
+	r.c.parallelize(len(visit), func(i int) {
+		ns := visit[i]
+		fields := log.Fields{"kind": kind, "name": newObj.GetName(), "namespace": ns}
+		if err := r.syncVersions(source, newObj, ns); err != nil {
+			fail(ns, "Version sync", reasonCreateFailed, err)
+			return
+		}
+
+		target, err := r.kind.Get(ns, newObj.GetName())
+		if errors.IsNotFound(err) {
+			if !budget.take() {
+				deferTarget(ns)
+				return
+			}
+			err = r.kind.Create(inNamespace(newObj, ns))
+			countOperation(kind, "create", err)
+			if err == nil {
+				log.WithFields(fields).Info("Copy added")
+				count(true)
+				return
+			}
+			if !errors.IsAlreadyExists(err) {
+				fail(ns, "Create", reasonCreateFailed, err)
+				return
+			}
+			//Cache hasn't caught up with the existing object, check who owns it
+			log.WithFields(fields).Debug("Copy already exists, checking ownership")
+			target, err = r.kind.Fetch(ns, newObj.GetName())
+		}
+		if err != nil {
+			fail(ns, "Get", "", err)
+			return
+		}
+
+		m, managed := metadataFromAnnotations(target.GetAnnotations())
+		if managed {
+			other, err := r.c.collidingSource(source, m, ns, r.get)
+			if err != nil {
+				fail(ns, "Collision check", "", err)
+				return
+			}
+			if other != nil {
+				log.WithFields(fields).WithField("owner", m.originKey()).Warn("Copy is owned by another source with higher precedence, dont sync")
+				r.c.recorder.Eventf(source, corev1.EventTypeWarning, reasonCollision, "Collision with %s/%s in namespace %s", other.GetNamespace(), other.GetName(), ns)
+				status.failure(ns, fmt.Sprintf("collision with %s/%s", other.GetNamespace(), other.GetName()))
+				return
+			}
+		} else if !r.c.canAdopt(source, target, r.kind.Equal(newObj, target)) {
+			log.WithFields(fields).WithField("policy", r.c.adoptionPolicy(source)).Warn("Object exists and isn't managed by konfig-syncer, dont overwrite")
+			r.c.recorder.Eventf(source, corev1.EventTypeWarning, reasonNotOwned, "Skipped namespace %s: %s exists and isn't managed by konfig-syncer", ns, kind)
+			status.failure(ns, "exists and isn't managed by konfig-syncer")
+			return
+		}
+
+		desired := inNamespace(newObj, ns)
+		if allowsDrift(target.GetAnnotations()) {
+			desired.SetAnnotations(withAllowDrift(newObj.GetAnnotations()))
+		}
+
+		if managed && m.isOrigin(source) {
+			if allowsDrift(target.GetAnnotations()) && !markedForDeletion(target.GetAnnotations()) && m.ResourceVersion == status.ObservedResourceVersion {
+				log.WithFields(fields).Debug("Copy allows drift and source hasn't changed, dont sync")
+				count(false)
+				return
+			}
+			if m.UID == string(source.GetUID()) && m.deletionPolicy() == deletionPolicy(source) && r.upToDate(desired, target) {
+				log.WithFields(fields).Debug("Copy hasn't changed, dont sync")
+				count(false)
+				return
+			}
+		}
+
+		if !budget.take() {
+			deferTarget(ns)
+			return
+		}
+
+		if r.kind.NeedsRecreate(desired, target) {
+			err = r.recreate(target, desired)
+			if err != nil {
+				fail(ns, "Recreate", reasonUpdateFailed, err)
+				return
+			}
+			count(true)
+			log.WithFields(fields).Info("Copy recreated as it can't be updated")
+			r.c.recorder.Eventf(source, corev1.EventTypeNormal, reasonRecreated, "Recreated %s in namespace %s as it can't be updated", kind, ns)
+			return
+		}
+
+		_, err = r.update(target, func(current object) object {
+			d := desired.DeepCopyObject().(object)
+			d.SetResourceVersion(current.GetResourceVersion())
+			return d
+		})
+		countOperation(kind, "update", err)
+		if isImmutableError(err) {
+			err = r.recreate(target, desired)
+			if err != nil {
+				fail(ns, "Recreate", reasonUpdateFailed, err)
+				return
+			}
+			count(true)
+			log.WithFields(fields).Info("Immutable copy recreated")
+			r.c.recorder.Eventf(source, corev1.EventTypeNormal, reasonRecreated, "Recreated immutable %s in namespace %s", kind, ns)
+			return
+		}
+		if err != nil {
+			fail(ns, "Update", reasonUpdateFailed, err)
+			return
+		}
+		log.WithFields(fields).Info("Copy updated")
+		r.c.recorder.Eventf(target, corev1.EventTypeNormal, reasonUpdated, "Updated from %s/%s", source.GetNamespace(), source.GetName())
+		count(true)
+	})
+
+	if changed > 0 {
+		r.c.recorder.Eventf(source, corev1.EventTypeNormal, reasonSynced, "Synced to %d namespaces", synced)
+	}
+
+	status.Synced = synced
+	status.Pending = pending.Len()
+
+	//Retries revisit every failed or blocked namespace, including the ones that failed without an error like collisions
+	failed := sets.NewString()
+	if len(errs) > 0 && lastAttempt && pending.Len() == 0 {
+		status.DeadLetter = true
+		log.WithFields(r.fields(source)).WithField("failed", status.Failed).Error("Giving up syncing source")
+		r.c.recorder.Eventf(source, corev1.EventTypeWarning, reasonRetriesExhausted, "Giving up after %d retries, failed in %d namespaces", r.c.maxRetries, status.Failed)
+	} else if len(errs) > 0 {
+		failed = sets.StringKeySet(status.Failures).Union(sets.StringKeySet(status.Blocked))
+	}
+	//Namespaces left over by the write budget are visited on the next pass
+	r.failed.set(key, status.Hash, failed, pending)
+	if pending.Len() > 0 {
+		log.WithFields(r.fields(source)).WithField("pending", pending.Len()).Info("Write budget used up, continuing on next pass")
+	}
+
+	//Delete copies from namespaces that are no longer targeted
+	errs = append(errs, r.deleteSynced(source, namespaces, deletionConfirmed(source.GetAnnotations())))
+	errs = append(errs, r.updateStatus(source, status))
+	return utilerrors.NewAggregate(errs)
+}
+
+// targetFailed records the failure to sync source to namespace ns according to the class of err,
+// action being the capitalised name of the failed step used in events.
+// Returns the error when syncing to the namespace should be retried.
+func (r *reconciler) targetFailed(source object, status *syncStatus, ns, action, reason string, err error) error {
+	event := action
+	action = strings.ToLower(action)
+	fields := log.Fields{"kind": r.kind.Kind(), "name": source.GetName(), "namespace": ns, "action": action}
+	switch {
+	case isTerminatingError(err):
+		log.WithFields(fields).Debug("Namespace is terminating, skip")
+		status.skip()
+		return nil
+	case isBlockedError(err):
+		log.WithFields(fields).Warn(err)
+		r.c.recorder.Eventf(source, corev1.EventTypeWarning, reasonBlocked, "Blocked in namespace %s: %v", ns, err)
+		status.block(ns, fmt.Sprintf("%s forbidden: %v", action, err))
+	case isPermanentError(err):
+		log.WithFields(fields).Error(err)
+		r.c.recorder.Eventf(source, corev1.EventTypeWarning, reasonInvalid, "Rejected in namespace %s: %v", ns, err)
+		status.failure(ns, fmt.Sprintf("%s rejected: %v", action, err))
+		return nil
+	default:
+		log.WithFields(fields).Error(err)
+		if reason != "" {
+			r.c.recorder.Eventf(source, corev1.EventTypeWarning, reason, "%s failed in namespace %s: %v", event, ns, err)
+		}
+		status.failure(ns, fmt.Sprintf("%s failed: %v", action, err))
+	}
+	return targetError{namespace: ns, err: err}
+}
+
+// update writes the object mutate returns for a copy of obj.
+// On conflict obj is read again from the API server and mutate is applied to the fresh copy.
+func (r *reconciler) update(obj object, mutate func(current object) object) (object, error) {
+	current := obj
+	var updated object
+	err := retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		var err error
+		updated, err = r.kind.Update(mutate(current.DeepCopyObject().(object)))
+		if errors.IsConflict(err) {
+			fresh, fetchErr := r.kind.Fetch(obj.GetNamespace(), obj.GetName())
+			if fetchErr != nil {
+				return fetchErr
+			}
+			current = fresh
+		}
+		return err
+	})
+	return updated, err
+}
+
+// updateStatus writes the sync status on the source if it has changed
+func (r *reconciler) updateStatus(source object, status *syncStatus) error {
+	if withStatus(source, status) == nil {
+		return nil
+	}
+	_, err := r.update(source, func(s object) object {
+		if annotations := withStatus(s, status); annotations != nil {
+			s.SetAnnotations(annotations)
+		}
+		return s
+	})
+	return err
+}
+
+// deleteSynced removes copies synced from source in all namespaces except the ones in keep,
+// following the deletion policy of source
+func (r *reconciler) deleteSynced(source object, keep sets.String, confirmed bool) error {
+	copies, err := r.kind.List("")
+	if err != nil {
+		return err
+	}
+
+	var candidates []object
+	total := 0
+	for _, existing := range copies {
+		if existing.GetNamespace() == source.GetNamespace() {
+			continue
+		}
+		if m, ok := metadataFromAnnotations(existing.GetAnnotations()); !ok || !m.isOrigin(source) {
+			continue
+		}
+		total++
+		if !keep.Has(existing.GetNamespace()) {
+			candidates = append(candidates, existing)
+		}
+	}
+
+	policy := deletionPolicy(source)
+	planned := 0
+	if policy == deletionPolicyDelete {
+		for _, existing := range candidates {
+			//Copies already marked passed the safeguard when they were marked
+			if !markedForDeletion(existing.GetAnnotations()) {
+				planned++
+			}
+		}
+	}
+	if err := r.c.guardDeletion(r.kind.Kind(), source, planned, total, confirmed); err != nil {
+		return err
+	}
+
+	var errs []error
+	for _, existing := range candidates {
+		if err := r.removeCopy(existing, policy); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	if len(candidates) > 0 {
+		r.enqueueColliding(source)
+	}
+	return utilerrors.NewAggregate(errs)
+}
+
+// awaitingDeletion tells if copies of source are left to be deleted once their grace period has passed
+func (r *reconciler) awaitingDeletion(source object) bool {
+	if r.c.deletionGracePeriod <= 0 || deletionPolicy(source) != deletionPolicyDelete {
+		return false
+	}
+	copies, err := r.kind.List("")
+	if err != nil {
+		return true
+	}
+	for _, existing := range copies {
+		if existing.GetNamespace() == source.GetNamespace() {
+			continue
+		}
+		if m, ok := metadataFromAnnotations(existing.GetAnnotations()); ok && m.isOrigin(source) {
+			return true
+		}
+	}
+	return false
+}
+
+// recreate replaces existing copy with desired one for changes that can't be done with an update
+func (r *reconciler) recreate(existing, desired object) error {
+	uid := existing.GetUID()
+	err := r.kind.Delete(existing.GetNamespace(), existing.GetName(), &metav1.DeleteOptions{Preconditions: &metav1.Preconditions{UID: &uid}})
+	countOperation(r.kind.Kind(), "delete", err)
+	if err != nil && !errors.IsNotFound(err) {
+		return err
+	}
+	created := desired.DeepCopyObject().(object)
+	created.SetResourceVersion("")
+	err = r.kind.Create(created)
+	countOperation(r.kind.Kind(), "create", err)
+	return err
+}
+
+// syncVersions creates the current versioned copy of a versioned source in namespace ns
+// and deletes old versions that fall out of retention. Failing to delete old versions is only logged.
+func (r *reconciler) syncVersions(source, alias object, ns string) error {
+	kind := r.kind.Kind()
+	current := alias.GetAnnotations()[currentVersionAnnotation]
+	if current != "" {
+		existing, err := r.kind.Get(ns, current)
+		if errors.IsNotFound(err) {
+			version := inNamespace(alias, ns)
+			version.SetName(current)
+			annotations := version.GetAnnotations()
+			delete(annotations, currentVersionAnnotation)
+			annotations[versionAnnotation] = r.kind.Hash(source)
+			version.SetAnnotations(annotations)
+			err = r.kind.Create(version)
+			countOperation(kind, "create", err)
+			if err == nil {
+				log.WithFields(log.Fields{"kind": kind, "name": current, "namespace": ns}).Info("Versioned copy added")
+			} else if errors.IsAlreadyExists(err) {
+				//Cache hasn't caught up with the existing version, check who owns it
+				existing, err = r.kind.Fetch(ns, current)
+			}
+		}
+		if err != nil {
+			return err
+		}
+		if existing != nil {
+			if m, ok := metadataFromAnnotations(existing.GetAnnotations()); !ok || !m.isOrigin(source) {
+				log.WithFields(log.Fields{"kind": kind, "name": current, "namespace": ns}).Warn("Versioned copy exists and isn't managed by this source, dont overwrite")
+				r.c.recorder.Eventf(source, corev1.EventTypeWarning, reasonNotOwned, "Skipped version %s in namespace %s: %s exists and isn't managed by this source", current, ns, kind)
+			}
+		}
+	}
+
+	copies, err := r.kind.List(ns)
+	if err != nil {
+		log.Error(err)
+		return err
+	}
+	objs := make([]metav1.Object, 0, len(copies))
+	for _, o := range copies {
+		objs = append(objs, o)
+	}
+	for _, expired := range expiredVersions(source, objs, current, retainVersions(source)) {
+		err = r.kind.Delete(ns, expired.GetName(), &metav1.DeleteOptions{})
+		countOperation(kind, "delete", err)
+		if err != nil && !errors.IsNotFound(err) {
+			log.Error(err)
+			continue
+		}
+		log.WithFields(log.Fields{"kind": kind, "name": expired.GetName(), "namespace": ns}).Info("Old versioned copy deleted")
+	}
+	return nil
+}
+
+// removeCopy gets rid of a copy that is no longer wanted according to the deletion policy
+func (r *reconciler) removeCopy(copy object, policy string) error {
+	kind := r.kind.Kind()
+	fields := r.fields(copy)
+	fields["policy"] = policy
+	switch policy {
+	case deletionPolicyRetain:
+		log.WithFields(fields).Debug("Copy retained")
+		return nil
+	case deletionPolicyOrphan:
+		_, err := r.update(copy, func(orphan object) object {
+			annotations := orphan.GetAnnotations()
+			delete(annotations, metadataAnnotation)
+			orphan.SetAnnotations(annotations)
+			return orphan
+		})
+		countOperation(kind, "update", err)
+		if err != nil && !errors.IsNotFound(err) {
+			r.c.recorder.Eventf(copy, corev1.EventTypeWarning, reasonUpdateFailed, "Orphaning failed: %v", err)
+			return err
+		}
+		log.WithFields(fields).Info("Copy orphaned")
+		r.c.recorder.Eventf(copy, corev1.EventTypeNormal, reasonOrphaned, "No longer managed by konfig-syncer, left in place by deletion policy")
+		return nil
+	}
+
+	due, marked := r.c.deletionDue(copy)
+	if marked != nil {
+		_, err := r.update(copy, func(mark object) object {
+			annotations := mark.GetAnnotations()
+			if annotations == nil {
+				annotations = make(map[string]string)
+			}
+			annotations[deleteAfterAnnotation] = marked[deleteAfterAnnotation]
+			mark.SetAnnotations(annotations)
+			return mark
+		})
+		countOperation(kind, "update", err)
+		if err != nil && !errors.IsNotFound(err) {
+			r.c.recorder.Eventf(copy, corev1.EventTypeWarning, reasonUpdateFailed, "Marking for deletion failed: %v", err)
+			return err
+		}
+		r.c.recorder.Eventf(copy, corev1.EventTypeNormal, reasonMarkedForDeletion, "Will be deleted after %s", marked[deleteAfterAnnotation])
+		log.WithFields(fields).WithField("deleteAfter", marked[deleteAfterAnnotation]).Info("Copy marked for deletion")
+		r.c.scheduleDeletion(copy, r.queue)
+		return nil
+	}
+	if !due {
+		log.WithFields(fields).Debug("Copy marked for deletion, grace period hasn't passed")
+		return nil
+	}
+
+	err := r.kind.Delete(copy.GetNamespace(), copy.GetName(), &metav1.DeleteOptions{})
+	countOperation(kind, "delete", err)
+	if err != nil && !errors.IsNotFound(err) {
+		r.c.recorder.Eventf(copy, corev1.EventTypeWarning, reasonDeleteFailed, "Delete failed: %v", err)
+		return err
+	}
+	log.WithFields(fields).Info("Copy deleted")
+	r.c.recorder.Eventf(copy, corev1.EventTypeNormal, reasonDeleted, "Deleted as it's no longer synced from its source")
+	return nil
+}
+
+// enqueueColliding enqueues other sources syncing an object with the same name,
+// so they can take over copies once source no longer owns them
+func (r *reconciler) enqueueColliding(source metav1.Object) {
+	sources, err := r.kind.List("")
+	if err != nil {
+		log.Error(err)
+		return
+	}
+	for _, other := range sources {
+		if other.GetName() == source.GetName() && other.GetNamespace() != source.GetNamespace() && isSource(other.GetAnnotations()) {
+			r.enqueue(other)
+		}
+	}
+}
+
+// syncToNamespace creates the missing copies of every source targeting namespace and removes the ones no longer targeting it
+func (r *reconciler) syncToNamespace(namespace *corev1.Namespace) error {
+	ns := namespace.Name
+	kind := r.kind.Kind()
+	sources, err := r.kind.List("")
+	if err != nil {
+		return err
+	}
+
+	var errs []error
+	var creates []object
+	for _, s := range sources {
+		if !isSource(s.GetAnnotations()) {
+			//Skip objects that dont have our annotation
+			continue
+		}
+
+		t, err := targetFromAnnotations(s.GetAnnotations())
+		if err != nil {
+			log.WithFields(r.fields(s)).WithField("annotation", s.GetAnnotations()).Warn("Annotation not valid")
+			continue
+		}
+
+		if s.GetNamespace() != ns && r.c.namespaceTargeted(t, namespace) {
+			if isVersioned(s) {
+				//Versioned copies are maintained by the source sync
+				r.enqueue(s)
+				continue
+			}
+
+			existing, err := r.kind.Get(ns, s.GetName())
+			if err == nil {
+				if m, ok := metadataFromAnnotations(existing.GetAnnotations()); ok && !m.isOrigin(s) {
+					//Let the source sync resolve which one of the colliding sources owns the copy
+					r.enqueue(s)
+				} else if markedForDeletion(existing.GetAnnotations()) {
+					//Namespace is targeted again, source sync removes the deletion mark
+					r.enqueue(s)
+				}
+			} else if errors.IsNotFound(err) {
+				creates = append(creates, s)
+			} else {
+				log.Error(err)
+				errs = append(errs, err)
+			}
+		}
+	}
+
+	//Namespace may be targeted by many sources, write the copies through the shared pool
+	var mu sync.Mutex
+	r.c.parallelize(len(creates), func(i int) {
+		s := creates[i]
+		fields := log.Fields{"kind": kind, "name": s.GetName(), "namespace": ns}
+		log.WithFields(fields).Info("Adding copy")
+		err := r.kind.Create(inNamespace(r.desired(s), ns))
+		countOperation(kind, "create", err)
+		switch {
+		case err == nil:
+			r.c.recorder.Eventf(s, corev1.EventTypeNormal, reasonSynced, "Synced to new namespace %s", ns)
+		case isTerminatingError(err):
+			log.WithFields(fields).Debug("Namespace is terminating, skip")
+		case errors.IsAlreadyExists(err), isBlockedError(err), isPermanentError(err):
+			//Let the source sync check ownership and report the failure in its status
+			r.enqueue(s)
+		default:
+			log.Error(err)
+			r.c.recorder.Eventf(s, corev1.EventTypeWarning, reasonCreateFailed, "Create failed in namespace %s: %v", ns, err)
+			mu.Lock()
+			errs = append(errs, err)
+			mu.Unlock()
+		}
+	})
+	errs = append(errs, r.deleteDeprecatedFromNs(namespace))
+	return utilerrors.NewAggregate(errs)
+}
+
+// deleteDeprecatedFromNs removes copies in namespace whose source no longer targets it.
+// Deletions blocked by the safeguard aren't retried, they wait for the confirmation annotation.
+func (r *reconciler) deleteDeprecatedFromNs(namespace *corev1.Namespace) error {
+	ns := namespace.Name
+	copies, err := r.kind.List(ns)
+	if err != nil {
+		return err
+	}
+
+	var candidates []object
+	total, planned := 0, 0
+	for _, copy := range copies {
+		m, ok := metadataFromAnnotations(copy.GetAnnotations())
+		if !ok {
+			continue
+		}
+		total++
+
+		t, err := m.target()
+		if err != nil {
+			log.WithFields(r.fields(copy)).Warn(err)
+			continue
+		}
+
+		//Namespace is still targeted
+		if r.c.namespaceTargeted(t, namespace) {
+			continue
+		}
+
+		log.WithFields(log.Fields{"nsLabels": namespace.Labels, "metadata": copy.GetAnnotations()[metadataAnnotation]}).Debug("Copy didnt match labels")
+		candidates = append(candidates, copy)
+		if m.deletionPolicy() == deletionPolicyDelete && !markedForDeletion(copy.GetAnnotations()) {
+			planned++
+		}
+	}
+
+	if err := r.c.guardDeletion(r.kind.Kind(), namespace, planned, total, deletionConfirmed(namespace.Annotations)); err != nil {
+		return nil
+	}
+
+	var errs []error
+	for _, copy := range candidates {
+		m, _ := metadataFromAnnotations(copy.GetAnnotations())
+		if err := r.removeCopy(copy, m.deletionPolicy()); err != nil {
+			log.Error(err)
+			errs = append(errs, err)
+			continue
+		}
+		r.enqueueColliding(copy)
+	}
+	return utilerrors.NewAggregate(errs)
+}
+
+// collectGarbage removes copies of the kind whose source is gone or no longer targets their namespace
+func (r *reconciler) collectGarbage() {
+	copies, err := r.kind.List("")
+	if err != nil {
+		log.Error(err)
+	}
+
+	//Orphans are grouped by source so the mass deletion safeguard applies per source like in syncs
+	total := map[string]int{}
+	orphans := map[string][]object{}
+	reasons := map[object]string{}
+	var origins []string
+	for _, copy := range copies {
+		m, ok := metadataFromAnnotations(copy.GetAnnotations())
+		if !ok {
+			continue
+		}
+		origin := m.originKey()
+		total[origin]++
+		reason := r.c.orphanReason(copy, r.get)
+		if reason == "" || m.deletionPolicy() == deletionPolicyRetain {
+			continue
+		}
+		fields := r.fields(copy)
+		fields["reason"] = reason
+		fields["dryRun"] = r.c.gcDryRun
+		if r.c.gcDryRun {
+			log.WithFields(fields).Warn("Orphaned copy found")
+			r.c.recorder.Eventf(copy, corev1.EventTypeWarning, reasonOrphaned, "Orphaned copy: %s", reason)
+			continue
+		}
+		if _, ok := orphans[origin]; !ok {
+			origins = append(origins, origin)
+		}
+		orphans[origin] = append(orphans[origin], copy)
+		reasons[copy] = reason
+	}
+
+	for _, origin := range origins {
+		group := orphans[origin]
+		planned := 0
+		for _, copy := range group {
+			m, _ := metadataFromAnnotations(copy.GetAnnotations())
+			if m.deletionPolicy() == deletionPolicyDelete && !markedForDeletion(copy.GetAnnotations()) {
+				planned++
+			}
+		}
+
+		//Blocked deletions are reported on the source, or on one of the copies if the source is gone
+		var owner object = group[0]
+		if m, _ := metadataFromAnnotations(group[0].GetAnnotations()); m != nil {
+			if source, err := r.kind.Get(m.Namespace, m.Name); err == nil {
+				owner = source
+			}
+		}
+		if err := r.c.guardDeletion(r.kind.Kind(), owner, planned, total[origin], deletionConfirmed(owner.GetAnnotations())); err != nil {
+			continue
+		}
+
+		for _, copy := range group {
+			m, _ := metadataFromAnnotations(copy.GetAnnotations())
+			log.WithFields(r.fields(copy)).WithField("reason", reasons[copy]).Info("Removing orphaned copy")
+			if err := r.removeCopy(copy, m.deletionPolicy()); err != nil {
+				log.Error(err)
+			}
+		}
+	}
+}
+
+// managedCopies counts the copies of the kind per source
+func (r *reconciler) managedCopies() map[copyOrigin]int {
+	copies, err := r.kind.List("")
+	if err != nil {
+		return nil
+	}
+	counts := map[copyOrigin]int{}
+	for _, copy := range copies {
+		if m, ok := metadataFromAnnotations(copy.GetAnnotations()); ok {
+			counts[copyOrigin{m.Namespace, m.Name}]++
+		}
+	}
+	return counts
+}
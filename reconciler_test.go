@@ -0,0 +1,199 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	kubeinformers "k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/tools/record"
+)
+
+// fixture is a controller backed by a fake clientset whose informer caches are filled by hand
+type fixture struct {
+	t         *testing.T
+	client    *fake.Clientset
+	informers kubeinformers.SharedInformerFactory
+	c         *Controller
+	recorder  *record.FakeRecorder
+}
+
+func newFixture(t *testing.T, objects ...runtime.Object) *fixture {
+	client := fake.NewSimpleClientset()
+	informers := kubeinformers.NewSharedInformerFactory(client, 0)
+	c := NewController(client,
+		informers.Core().V1().ConfigMaps(),
+		informers.Core().V1().Secrets(),
+		informers.Core().V1().Namespaces(),
+		nil, nil,
+		Options{TargetConcurrency: 1},
+	)
+	recorder := record.NewFakeRecorder(100)
+	c.recorder = recorder
+
+	f := &fixture{t: t, client: client, informers: informers, c: c, recorder: recorder}
+	f.add(objects...)
+	return f
+}
+
+// add creates objects in the fake API server and in the informer caches
+func (f *fixture) add(objects ...runtime.Object) {
+	for _, o := range objects {
+		var err error
+		switch o := o.(type) {
+		case *corev1.Namespace:
+			_, err = f.client.CoreV1().Namespaces().Create(o)
+		case *corev1.Secret:
+			_, err = f.client.CoreV1().Secrets(o.Namespace).Create(o)
+		case *corev1.ConfigMap:
+			_, err = f.client.CoreV1().ConfigMaps(o.Namespace).Create(o)
+		}
+		if err != nil {
+			f.t.Fatal(err)
+		}
+		switch o := o.(type) {
+		case *corev1.Namespace:
+			err = f.informers.Core().V1().Namespaces().Informer().GetIndexer().Add(o)
+		case *corev1.Secret:
+			err = f.informers.Core().V1().Secrets().Informer().GetIndexer().Add(o)
+		case *corev1.ConfigMap:
+			err = f.informers.Core().V1().ConfigMaps().Informer().GetIndexer().Add(o)
+		}
+		if err != nil {
+			f.t.Fatal(err)
+		}
+	}
+	f.client.ClearActions()
+}
+
+// refresh replaces the cached Secrets with the ones in the fake API server, as the informer would
+func (f *fixture) refresh() {
+	list, err := f.client.CoreV1().Secrets(metav1.NamespaceAll).List(metav1.ListOptions{})
+	if err != nil {
+		f.t.Fatal(err)
+	}
+	items := make([]interface{}, 0, len(list.Items))
+	for i := range list.Items {
+		items = append(items, &list.Items[i])
+	}
+	if err := f.informers.Core().V1().Secrets().Informer().GetIndexer().Replace(items, ""); err != nil {
+		f.t.Fatal(err)
+	}
+	f.client.ClearActions()
+}
+
+// secrets returns the reconciler of Secrets
+func (f *fixture) secrets() *reconciler {
+	return f.c.reconcilers[0]
+}
+
+// copyOf returns the copy of source synced to namespace ns
+func (f *fixture) copyOf(source *corev1.Secret, ns string) *corev1.Secret {
+	return inNamespace(f.secrets().desired(source), ns).(*corev1.Secret)
+}
+
+// secret reads a Secret from the fake API server, nil if it doesn't exist
+func (f *fixture) secret(ns, name string) *corev1.Secret {
+	s, err := f.client.CoreV1().Secrets(ns).Get(name, metav1.GetOptions{})
+	if err != nil {
+		return nil
+	}
+	return s
+}
+
+// status returns the sync status written on source
+func (f *fixture) status(source *corev1.Secret) *syncStatus {
+	s := f.secret(source.Namespace, source.Name)
+	if s == nil {
+		f.t.Fatalf("source %s/%s not found", source.Namespace, source.Name)
+	}
+	status, ok := statusFromAnnotations(s.Annotations)
+	if !ok {
+		f.t.Fatalf("source %s/%s has no status", source.Namespace, source.Name)
+	}
+	return status
+}
+
+// events returns the events recorded so far
+func (f *fixture) events() []string {
+	var events []string
+	for {
+		select {
+		case e := <-f.recorder.Events:
+			events = append(events, e)
+		default:
+			return events
+		}
+	}
+}
+
+// expectEvent fails the test if no recorded event contains text
+func (f *fixture) expectEvent(text string) {
+	f.t.Helper()
+	events := f.events()
+	for _, e := range events {
+		if strings.Contains(e, text) {
+			return
+		}
+	}
+	f.t.Errorf("no event with %q in %v", text, events)
+}
+
+// origin returns the key of the source that copy was synced from, empty if it isn't managed
+func origin(copy *corev1.Secret) string {
+	if copy == nil {
+		return ""
+	}
+	m, ok := metadataFromAnnotations(copy.Annotations)
+	if !ok {
+		return ""
+	}
+	return m.originKey()
+}
+
+func newNamespace(name string) *corev1.Namespace {
+	return &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: name}}
+}
+
+// newSource returns a Secret synced to namespaces, created age ago
+func newSource(ns, name, namespaces, data string, age time.Duration) *corev1.Secret {
+	return &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace:         ns,
+			Name:              name,
+			UID:               types.UID(ns + "-" + name),
+			ResourceVersion:   "1",
+			CreationTimestamp: metav1.NewTime(time.Now().Add(-age)),
+			Annotations:       map[string]string{namespacesAnnotation: namespaces},
+			Finalizers:        []string{cleanupFinalizer},
+		},
+		Data: map[string][]byte{"key": []byte(data)},
+	}
+}
+
+func TestSyncCreatesCopies(t *testing.T) {
+	source := newSource("a", "foo", "b,c", "v1", time.Hour)
+	f := newFixture(t, newNamespace("a"), newNamespace("b"), newNamespace("c"), source)
+
+	if err := f.secrets().sync("a/foo", false); err != nil {
+		t.Fatal(err)
+	}
+	for _, ns := range []string{"b", "c"} {
+		copy := f.secret(ns, "foo")
+		if origin(copy) != "a/foo" {
+			t.Fatalf("copy in %s not synced from a/foo: %v", ns, copy)
+		}
+		if string(copy.Data["key"]) != "v1" {
+			t.Errorf("copy in %s has data %q", ns, copy.Data["key"])
+		}
+	}
+	if s := f.status(source); s.Targeted != 2 || s.Synced != 2 || s.Failed != 0 {
+		t.Errorf("status %+v, want 2 targeted and synced", s)
+	}
+	f.expectEvent("Synced to 2 namespaces")
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+
+	"k8s.io/apimachinery/pkg/util/sets"
+)
+
+// targetError is a failure to sync a source to a single namespace
+type targetError struct {
+	namespace string
+	err       error
+}
+
+func (e targetError) Error() string {
+	return fmt.Sprintf("namespace %s: %v", e.namespace, e.err)
+}
+
+// failedTargets remembers the namespaces each source failed to sync to or left pending,
+// so retries and later passes of an unchanged source only visit those
+type failedTargets struct {
+	mu      sync.Mutex
+	targets map[string]retryTargets
+}
+
+type retryTargets struct {
+	// hash of the source the failures belong to, a changed source syncs to every namespace again
+	hash       string
+	namespaces sets.String
+	// pending are the namespaces left over by the write budget, they are part of namespaces too
+	pending sets.String
+}
+
+func newFailedTargets() *failedTargets {
+	return &failedTargets{targets: make(map[string]retryTargets)}
+}
+
+// get returns namespaces to retry for source key, nil if all targeted namespaces should be synced
+func (f *failedTargets) get(key, hash string) sets.String {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	t, ok := f.targets[key]
+	if !ok || t.hash != hash {
+		return nil
+	}
+	return t.namespaces
+}
+
+// set records the failed and pending namespaces of source key, forgetting the key when nothing is left
+func (f *failedTargets) set(key, hash string, failed, pending sets.String) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	namespaces := failed.Union(pending)
+	if namespaces.Len() == 0 {
+		delete(f.targets, key)
+		return
+	}
+	f.targets[key] = retryTargets{hash: hash, namespaces: namespaces, pending: pending}
+}
+
+// hasPending tells if the last sync of source key left namespaces over by the write budget
+func (f *failedTargets) hasPending(key string) bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.targets[key].pending.Len() > 0
+}
+
+// clearPending is called before syncing source key, so a sync that returns early doesn't continue a stale fan-out.
+// The pending namespaces are still visited by the next sync.
+func (f *failedTargets) clearPending(key string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if t, ok := f.targets[key]; ok {
+		t.pending = nil
+		f.targets[key] = t
+	}
+}
+
+// forget makes the next sync of source key visit every targeted namespace
+func (f *failedTargets) forget(key string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	delete(f.targets, key)
+}
+
+// retriesExhausted tells if item has used up the retry budget, 0 retries forever
+func (c *Controller) retriesExhausted(requeues int) bool {
+	return c.maxRetries > 0 && requeues >= c.maxRetries
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/sets"
+	core "k8s.io/client-go/testing"
+)
+
+// failCreate makes creating Secrets in namespace ns fail while *fail is true
+func (f *fixture) failCreate(ns string, fail *bool) {
+	f.client.PrependReactor("create", "secrets", func(action core.Action) (bool, runtime.Object, error) {
+		if *fail && action.GetNamespace() == ns {
+			return true, nil, errors.NewInternalError(fmt.Errorf("injected failure"))
+		}
+		return false, nil, nil
+	})
+}
+
+// writtenNamespaces returns the namespaces Secrets were written to since actions were last cleared
+func (f *fixture) writtenNamespaces() sets.String {
+	written := sets.NewString()
+	for _, action := range f.client.Actions() {
+		if action.GetVerb() == "create" || action.GetVerb() == "update" {
+			written.Insert(action.GetNamespace())
+		}
+	}
+	return written
+}
+
+func TestRetryOnlyFailedNamespaces(t *testing.T) {
+	source := newSource("a", "foo", "b,c,d", "v1", time.Hour)
+	f := newFixture(t, newNamespace("a"), newNamespace("b"), newNamespace("c"), newNamespace("d"), source)
+	r := f.secrets()
+	fail := true
+	f.failCreate("c", &fail)
+
+	if err := r.sync("a/foo", false); err == nil {
+		t.Fatal("sync succeeded, want error from namespace c")
+	}
+	status := f.status(source)
+	if retry := r.failed.get("a/foo", status.Hash); !retry.Equal(sets.NewString("c")) {
+		t.Fatalf("retrying %v, want c", retry.List())
+	}
+	if s := f.secret("d", "foo"); origin(s) != "a/foo" {
+		t.Errorf("copy in d not synced despite failure in c")
+	}
+
+	f.refresh()
+	fail = false
+	if err := r.sync("a/foo", false); err != nil {
+		t.Fatal(err)
+	}
+	if written := f.writtenNamespaces(); written.Has("b") || written.Has("d") || !written.Has("c") {
+		t.Errorf("retry wrote to %v, want only c and the source", written.List())
+	}
+	if retry := r.failed.get("a/foo", status.Hash); retry != nil {
+		t.Errorf("still retrying %v after success", retry.List())
+	}
+
+	f.refresh()
+	changed := f.secret("a", "foo")
+	changed.Data["key"] = []byte("v2")
+	if _, err := f.client.CoreV1().Secrets("a").Update(changed); err != nil {
+		t.Fatal(err)
+	}
+	f.refresh()
+	if err := r.sync("a/foo", false); err != nil {
+		t.Fatal(err)
+	}
+	if written := f.writtenNamespaces(); !written.IsSuperset(sets.NewString("b", "c", "d")) {
+		t.Errorf("changed source wrote to %v, want every target", written.List())
+	}
+}
+
+func TestRetryDeadLetter(t *testing.T) {
+	source := newSource("a", "foo", "b,c", "v1", time.Hour)
+	f := newFixture(t, newNamespace("a"), newNamespace("b"), newNamespace("c"), source)
+	r := f.secrets()
+	fail := true
+	f.failCreate("c", &fail)
+
+	if err := r.sync("a/foo", true); err == nil {
+		t.Fatal("sync succeeded, want error from namespace c")
+	}
+	status := f.status(source)
+	if !status.DeadLetter {
+		t.Errorf("status %+v not dead lettered", status)
+	}
+	if retry := r.failed.get("a/foo", status.Hash); retry != nil {
+		t.Errorf("dead lettered source still retrying %v", retry.List())
+	}
+	f.expectEvent("Giving up after")
+}
+
+func TestRetryBackoff(t *testing.T) {
+	source := newSource("a", "foo", "b", "v1", time.Hour)
+	f := newFixture(t, newNamespace("a"), newNamespace("b"), source)
+	r := f.secrets()
+	fail := true
+	f.failCreate("b", &fail)
+
+	for i := 0; i < 5; i++ {
+		r.enqueueKey("a/foo")
+	}
+	if n := r.queue.NumRequeues("a/foo"); n != 0 {
+		t.Errorf("events counted as %d retries", n)
+	}
+
+	r.processNextItem()
+	if n := r.queue.NumRequeues("a/foo"); n != 1 {
+		t.Errorf("failed sync counted as %d retries, want 1", n)
+	}
+	r.queue.ShutDown()
+}
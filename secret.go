@@ -1,120 +1,109 @@
 package main
 
 import (
-	"fmt"
-	"reflect"
-	"time"
-
-	log "github.com/sirupsen/logrus"
 	corev1 "k8s.io/api/core/v1"
-	"k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
-	"k8s.io/apimachinery/pkg/util/runtime"
+	"k8s.io/apimachinery/pkg/labels"
+	coreinformers "k8s.io/client-go/informers/core/v1"
+	corev1client "k8s.io/client-go/kubernetes/typed/core/v1"
+	corelisters "k8s.io/client-go/listers/core/v1"
 	"k8s.io/client-go/tools/cache"
 )
 
-func (c *Controller) syncSecret(key string) error {
-	obj, exists, _ := c.deletedSecretIndexer.GetByKey(key)
-	if exists {
-		log.Debug("Cleanup secrets that were added by old origin Secret")
-		c.deletedSecretIndexer.Delete(key)
-		s := obj.(*corev1.Secret)
-		c.deleteSyncedSecrets(s)
+// secretKind adapts Secrets for the reconciler
+type secretKind struct {
+	client corev1client.SecretsGetter
+	lister corelisters.SecretLister
+	synced cache.InformerSynced
+}
+
+func newSecretKind(client corev1client.SecretsGetter, informer coreinformers.SecretInformer) *secretKind {
+	return &secretKind{
+		client: client,
+		lister: informer.Lister(),
+		synced: informer.Informer().HasSynced,
 	}
+}
+
+func (k *secretKind) Kind() string {
+	return "Secret"
+}
 
-	namespace, name, err := cache.SplitMetaNamespaceKey(key)
+func (k *secretKind) Synced() bool {
+	return k.synced()
+}
+
+func (k *secretKind) Get(namespace, name string) (object, error) {
+	s, err := k.lister.Secrets(namespace).Get(name)
 	if err != nil {
-		runtime.HandleError(fmt.Errorf("invalid resource key: %s", key))
-		return nil
+		return nil, err
 	}
+	return s, nil
+}
 
-	sourceSecret, err := c.secretsLister.Secrets(namespace).Get(name)
+func (k *secretKind) List(namespace string) ([]object, error) {
+	var secrets []*corev1.Secret
+	var err error
+	if namespace == "" {
+		secrets, err = k.lister.List(labels.Everything())
+	} else {
+		secrets, err = k.lister.Secrets(namespace).List(labels.Everything())
+	}
 	if err != nil {
-		if errors.IsNotFound(err) {
-			return nil
-		}
-		return err
+		return nil, err
+	}
+	objs := make([]object, 0, len(secrets))
+	for _, s := range secrets {
+		objs = append(objs, s)
 	}
+	return objs, nil
+}
 
-	namespaces, err := c.namespacesForLabel(sourceSecret.Annotations[syncAnnotation])
+func (k *secretKind) Fetch(namespace, name string) (object, error) {
+	s, err := k.client.Secrets(namespace).Get(name, metav1.GetOptions{})
 	if err != nil {
-		return nil
+		return nil, err
 	}
+	return s, nil
+}
 
-	newSecret := createNewSecret(sourceSecret)
-	for _, ns := range namespaces.UnsortedList() {
-		if ns == sourceSecret.Namespace {
-			continue
-		}
-		targetSecret, err := c.secretsLister.Secrets(ns).Get(newSecret.Name)
-		if err != nil {
-			if errors.IsNotFound(err) {
-				_, err = c.kubeclientset.CoreV1().Secrets(ns).Create(newSecret)
-				if err != nil {
-					log.Error(err)
-				}
-				log.WithFields(log.Fields{"secret": newSecret.Name, "namespace": ns}).Info("Secret added")
-				continue
-			} else {
-				log.Error(err)
-			}
-			continue
-		}
-
-		if reflect.DeepEqual(targetSecret.Data, newSecret.Data) {
-			log.WithFields(log.Fields{"secret": newSecret.Name, "namespace": ns}).Debug("Data hasn't changed, dont sync")
-			continue
-		}
-		_, err = c.kubeclientset.CoreV1().Secrets(ns).Update(newSecret)
-		if err != nil {
-			log.Error(err)
-		}
-		log.WithFields(log.Fields{"secret": newSecret.Name, "namespace": ns}).Info("Secret updated")
-
-	}
-	return nil
+func (k *secretKind) Create(obj object) error {
+	_, err := k.client.Secrets(obj.GetNamespace()).Create(obj.(*corev1.Secret))
+	return err
 }
 
-func (c *Controller) deleteSyncedSecrets(s *corev1.Secret) {
-	log.Debug("Secret was deleted, lets delete the synced copies")
-	namespaces, err := c.namespacesForLabel(s.Annotations[syncAnnotation])
+func (k *secretKind) Update(obj object) (object, error) {
+	s, err := k.client.Secrets(obj.GetNamespace()).Update(obj.(*corev1.Secret))
 	if err != nil {
-		log.Error(err)
-		return
+		return nil, err
 	}
+	return s, nil
+}
 
-	for _, ns := range namespaces.UnsortedList() {
-		if ns == s.Namespace {
-			continue
-		}
-		err = c.kubeclientset.CoreV1().Secrets(ns).Delete(s.Name, &metav1.DeleteOptions{})
-		if err != nil {
-			log.Error(err)
-		}
-		log.WithFields(log.Fields{"secret": s.Name, "namespace": ns}).Info("Secret deleted")
-	}
+func (k *secretKind) Delete(namespace, name string, options *metav1.DeleteOptions) error {
+	return k.client.Secrets(namespace).Delete(name, options)
 }
 
-func createNewSecret(sourceSecret *corev1.Secret) *corev1.Secret {
-	newSecret := sourceSecret.DeepCopy()
+func (k *secretKind) Desired(source object) object {
+	return source.(*corev1.Secret).DeepCopy()
+}
 
-	delete(newSecret.Annotations, syncAnnotation)
-	newSecret.ResourceVersion = ""
-	newSecret.Namespace = ""
-	newSecret.UID = ""
-	newSecret.GenerateName = ""
-	newSecret.SelfLink = ""
-	newSecret.CreationTimestamp.Reset()
-	if newSecret.Annotations == nil {
-		newSecret.Annotations = make(map[string]string)
-	}
-	kubeSyncAnnotationValue := fmt.Sprintf(`{"namespace":%q,"name":%q,"uid":%q,"resourceVersion":%q,"label":%q,"last-update":%q}`,
-		sourceSecret.Namespace,
-		sourceSecret.Name,
-		sourceSecret.UID,
-		sourceSecret.ResourceVersion,
-		sourceSecret.Annotations[syncAnnotation],
-		time.Now().String())
-	newSecret.Annotations[fmt.Sprintf("%s-%s", syncAnnotation, "metadata")] = kubeSyncAnnotationValue
-	return newSecret
+// Equal compares the payload of two Secrets
+func (k *secretKind) Equal(a, b object) bool {
+	sa, sb := a.(*corev1.Secret), b.(*corev1.Secret)
+	return sa.Type == sb.Type && byteMapsEqual(sa.Data, sb.Data)
+}
+
+// Hash returns hash of the Secret content used for naming versioned copies
+func (k *secretKind) Hash(obj object) string {
+	s := obj.(*corev1.Secret)
+	return contentHash(struct {
+		Type corev1.SecretType
+		Data map[string][]byte
+	}{s.Type, s.Data})
+}
+
+// NeedsRecreate tells if the type of the Secret has changed as it can't be updated
+func (k *secretKind) NeedsRecreate(desired, actual object) bool {
+	return desired.(*corev1.Secret).Type != actual.(*corev1.Secret).Type
 }
@@ -0,0 +1,25 @@
+package main
+
+import (
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	log "github.com/sirupsen/logrus"
+)
+
+// newServeMux returns handler for the HTTP endpoints of the controller
+func newServeMux(c *Controller) *http.ServeMux {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.Handler())
+	mux.HandleFunc("/healthz", c.healthz)
+	mux.HandleFunc("/readyz", c.readyz)
+	return mux
+}
+
+// serve runs the HTTP server, failing to listen is fatal as nothing could scrape or probe the controller
+func serve(address string, handler http.Handler) {
+	log.WithField("address", address).Info("Starting HTTP server")
+	if err := http.ListenAndServe(address, handler); err != nil {
+		log.Fatalf("Error running HTTP server: %s", err.Error())
+	}
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"encoding/json"
+	"reflect"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// statusAnnotation is maintained on the source and tells how far its last change has propagated
+const statusAnnotation string = syncAnnotation + "-status"
+
+// syncStatus is stored as json in the status annotation of every source
+type syncStatus struct {
+	// mu guards the counters and maps as namespaces are synced concurrently
+	mu sync.Mutex
+
+	ObservedResourceVersion string            `json:"observed-resource-version"`
+	Hash                    string            `json:"hash"`
+	Targeted                int               `json:"targeted"`
+	Synced                  int               `json:"synced"`
+	Failed                  int               `json:"failed"`
+	Pending                 int               `json:"pending,omitempty"`
+	Failures                map[string]string `json:"failures,omitempty"`
+	Blocked                 map[string]string `json:"blocked,omitempty"`
+	LastSync                string            `json:"last-sync,omitempty"`
+	DeadLetter              bool              `json:"dead-letter,omitempty"`
+}
+
+func statusFromAnnotations(annotations map[string]string) (*syncStatus, bool) {
+	data, ok := annotations[statusAnnotation]
+	if !ok {
+		return nil, false
+	}
+
+	s := &syncStatus{}
+	if err := json.Unmarshal([]byte(data), s); err != nil {
+		log.WithFields(log.Fields{"data": data}).Error(err)
+		return nil, false
+	}
+	return s, true
+}
+
+// sourceHash returns hash of everything on the source that affects its copies, content being the hash of its data
+func sourceHash(source metav1.Object, content string) string {
+	annotations := make(map[string]string, len(source.GetAnnotations()))
+	for k, v := range source.GetAnnotations() {
+		annotations[k] = v
+	}
+	delete(annotations, statusAnnotation)
+	return contentHash(struct {
+		Labels      map[string]string
+		Annotations map[string]string
+		Content     string
+	}{source.GetLabels(), annotations, content})
+}
+
+// syncedVersion returns the resourceVersion of source its copies are synced from.
+// Writing the status bumps the resourceVersion of source, so as long as nothing else has changed
+// the version observed by the status is used instead.
+func syncedVersion(source metav1.Object, content string) string {
+	if s, ok := statusFromAnnotations(source.GetAnnotations()); ok && s.Hash == sourceHash(source, content) {
+		return s.ObservedResourceVersion
+	}
+	return source.GetResourceVersion()
+}
+
+func newSyncStatus(source metav1.Object, content string, targeted int) *syncStatus {
+	return &syncStatus{
+		ObservedResourceVersion: syncedVersion(source, content),
+		Hash:                    sourceHash(source, content),
+		Targeted:                targeted,
+	}
+}
+
+// failure records why syncing to namespace ns failed
+func (s *syncStatus) failure(ns, reason string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.Failures == nil {
+		s.Failures = make(map[string]string)
+	}
+	s.Failures[ns] = reason
+	s.Failed = len(s.Failures) + len(s.Blocked)
+}
+
+// block records why namespace ns refused the copy, e.g. RBAC or ResourceQuota
+func (s *syncStatus) block(ns, reason string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.Blocked == nil {
+		s.Blocked = make(map[string]string)
+	}
+	s.Blocked[ns] = reason
+	s.Failed = len(s.Failures) + len(s.Blocked)
+}
+
+// skip stops counting namespace as targeted, e.g. when it's being terminated
+func (s *syncStatus) skip() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.Targeted--
+}
+
+// withStatus returns annotations of source with the status set, nil if the status hasn't changed.
+// Last sync time is bumped when the observed version has reached every targeted namespace, with none left pending.
+func withStatus(source metav1.Object, s *syncStatus) map[string]string {
+	old, ok := statusFromAnnotations(source.GetAnnotations())
+	if ok {
+		s.LastSync = old.LastSync
+	}
+	if s.Failed == 0 && s.Pending == 0 && (!ok || old.Failed > 0 || old.Pending > 0 || old.ObservedResourceVersion != s.ObservedResourceVersion || old.LastSync == "") {
+		s.LastSync = time.Now().UTC().Format(time.RFC3339)
+	}
+	if ok && reflect.DeepEqual(old, s) {
+		return nil
+	}
+
+	b, _ := json.Marshal(s)
+	annotations := make(map[string]string, len(source.GetAnnotations())+1)
+	for k, v := range source.GetAnnotations() {
+		annotations[k] = v
+	}
+	annotations[statusAnnotation] = string(b)
+	return annotations
+}
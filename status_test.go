@@ -0,0 +1,61 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestWithStatus(t *testing.T) {
+	const lastSync = "2019-03-01T12:00:00Z"
+	source := func(old *syncStatus) metav1.Object {
+		s := &metav1.ObjectMeta{Namespace: "default", Name: "foo", ResourceVersion: "2", Annotations: map[string]string{syncAnnotation: ""}}
+		if old != nil {
+			b, _ := json.Marshal(old)
+			s.Annotations[statusAnnotation] = string(b)
+		}
+		return s
+	}
+	synced := func() *syncStatus {
+		return &syncStatus{ObservedResourceVersion: "1", Hash: "h", Targeted: 2, Synced: 2, LastSync: lastSync}
+	}
+
+	tests := []struct {
+		name        string
+		old         *syncStatus
+		new         *syncStatus
+		wantChanged bool
+		wantBumped  bool
+	}{
+		{"first sync", nil, synced(), true, true},
+		{"unchanged", synced(), synced(), false, false},
+		{"new version synced", synced(), &syncStatus{ObservedResourceVersion: "2", Hash: "h", Targeted: 2, Synced: 2}, true, true},
+		{"failing", synced(), &syncStatus{ObservedResourceVersion: "2", Hash: "h", Targeted: 2, Synced: 1, Failed: 1, Failures: map[string]string{"bar": "update failed"}}, true, false},
+		{"recovered", &syncStatus{ObservedResourceVersion: "1", Hash: "h", Targeted: 2, Synced: 1, Failed: 1, LastSync: lastSync}, synced(), true, true},
+		{"pending", synced(), &syncStatus{ObservedResourceVersion: "2", Hash: "h", Targeted: 2, Synced: 1, Pending: 1}, true, false},
+		{"pending done", &syncStatus{ObservedResourceVersion: "1", Hash: "h", Targeted: 2, Synced: 1, Pending: 1, LastSync: lastSync}, synced(), true, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := source(tt.old)
+			annotations := withStatus(s, tt.new)
+			if changed := annotations != nil; changed != tt.wantChanged {
+				t.Fatalf("withStatus() changed = %v, want %v", changed, tt.wantChanged)
+			}
+			if bumped := tt.new.LastSync != "" && tt.new.LastSync != lastSync; bumped != tt.wantBumped {
+				t.Errorf("withStatus() last sync = %q, bumped %v, want %v", tt.new.LastSync, bumped, tt.wantBumped)
+			}
+			if annotations == nil {
+				return
+			}
+			stored, ok := statusFromAnnotations(annotations)
+			if !ok {
+				t.Fatal("status annotation not set")
+			}
+			if stored.LastSync != tt.new.LastSync || stored.Synced != tt.new.Synced || stored.Pending != tt.new.Pending {
+				t.Errorf("stored status %+v, want %+v", stored, tt.new)
+			}
+		})
+	}
+}
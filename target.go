@@ -0,0 +1,182 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	labels "k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/util/sets"
+)
+
+const (
+	metadataAnnotation         string = syncAnnotation + "-metadata"
+	namespacesAnnotation       string = syncAnnotation + "/namespaces"
+	namespacePatternAnnotation string = syncAnnotation + "/namespace-pattern"
+	excludeAnnotation          string = syncAnnotation + "/exclude"
+
+	// ignoreLabel set to "true" on a Namespace makes it ignored as sync target
+	ignoreLabel string = syncAnnotation + "/ignore"
+)
+
+// targetAnnotations are the annotations that mark an object as sync source
+var targetAnnotations = []string{syncAnnotation, namespacesAnnotation, namespacePatternAnnotation}
+
+// target describes the namespaces a source object should be synced to.
+// A namespace is targeted if it matches any of the configured rules and
+// isn't matched by the exclude selector.
+type target struct {
+	selector labels.Selector
+	names    sets.String
+	pattern  *regexp.Regexp
+	exclude  labels.Selector
+}
+
+// syncMetadata is stored as json in the metadata annotation of every synced copy
+type syncMetadata struct {
+	Namespace        string  `json:"namespace"`
+	Name             string  `json:"name"`
+	UID              string  `json:"uid"`
+	ResourceVersion  string  `json:"resourceVersion"`
+	Label            *string `json:"label,omitempty"`
+	Namespaces       string  `json:"namespaces,omitempty"`
+	NamespacePattern string  `json:"namespace-pattern,omitempty"`
+	Exclude          string  `json:"exclude,omitempty"`
+	DeletionPolicy   string  `json:"deletion-policy,omitempty"`
+	LastUpdate       string  `json:"last-update"`
+}
+
+// isSource tells if object with given annotations should be synced to other namespaces
+func isSource(annotations map[string]string) bool {
+	for _, a := range targetAnnotations {
+		if _, ok := annotations[a]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+// targetChanged tells if any of the annotations deciding the target namespaces changed
+func targetChanged(old, new map[string]string) bool {
+	for _, a := range append(targetAnnotations, excludeAnnotation) {
+		ov, oldOk := old[a]
+		nv, newOk := new[a]
+		if oldOk != newOk || ov != nv {
+			return true
+		}
+	}
+	return false
+}
+
+// stripSourceAnnotations removes annotations that only have meaning on the source object
+func stripSourceAnnotations(annotations map[string]string) {
+	delete(annotations, statusAnnotation)
+	for k := range annotations {
+		if k == syncAnnotation || strings.HasPrefix(k, syncAnnotation+"/") {
+			delete(annotations, k)
+		}
+	}
+}
+
+func targetFromAnnotations(annotations map[string]string) (*target, error) {
+	var label *string
+	if l, ok := annotations[syncAnnotation]; ok {
+		label = &l
+	}
+	return newTarget(label, annotations[namespacesAnnotation], annotations[namespacePatternAnnotation], annotations[excludeAnnotation])
+}
+
+func newTarget(label *string, names string, pattern string, exclude string) (*target, error) {
+	t := &target{names: sets.NewString(splitList(names)...)}
+
+	if label != nil {
+		selector, err := parseSelector(*label)
+		if err != nil {
+			return nil, fmt.Errorf("%s not valid label selector: %s", *label, err)
+		}
+		t.selector = selector
+	}
+
+	if pattern != "" {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("%s not valid namespace pattern: %s", pattern, err)
+		}
+		t.pattern = re
+	}
+
+	if exclude != "" {
+		selector, err := labels.Parse(exclude)
+		if err != nil {
+			return nil, fmt.Errorf("%s not valid exclude selector: %s", exclude, err)
+		}
+		t.exclude = selector
+	}
+	return t, nil
+}
+
+func (t *target) matches(ns *v1.Namespace) bool {
+	if t.exclude != nil && t.exclude.Matches(labels.Set(ns.Labels)) {
+		return false
+	}
+	if t.selector != nil && t.selector.Matches(labels.Set(ns.Labels)) {
+		return true
+	}
+	if t.names.Has(ns.Name) {
+		return true
+	}
+	return t.pattern != nil && t.pattern.MatchString(ns.Name)
+}
+
+// parseSelector turns the value of the sync annotation into a label selector.
+// Empty value selects every namespace, anything else is parsed with the
+// standard Kubernetes selector grammar (eg. `env in (prod,staging),team!=legacy,!sandbox`)
+func parseSelector(label string) (labels.Selector, error) {
+	if label == "" {
+		return labels.Everything(), nil
+	}
+	return labels.Parse(label)
+}
+
+func newSyncMetadata(source metav1.Object, resourceVersion, lastUpdate string) string {
+	annotations := source.GetAnnotations()
+	m := syncMetadata{
+		Namespace:        source.GetNamespace(),
+		Name:             source.GetName(),
+		UID:              string(source.GetUID()),
+		ResourceVersion:  resourceVersion,
+		Namespaces:       annotations[namespacesAnnotation],
+		NamespacePattern: annotations[namespacePatternAnnotation],
+		Exclude:          annotations[excludeAnnotation],
+		DeletionPolicy:   annotations[deletionPolicyAnnotation],
+		LastUpdate:       lastUpdate,
+	}
+	if l, ok := annotations[syncAnnotation]; ok {
+		m.Label = &l
+	}
+	b, _ := json.Marshal(m)
+	return string(b)
+}
+
+// metadataFromAnnotations returns the parsed sync metadata of a synced copy
+func metadataFromAnnotations(annotations map[string]string) (*syncMetadata, bool) {
+	data, ok := annotations[metadataAnnotation]
+	if !ok {
+		return nil, false
+	}
+
+	m := &syncMetadata{}
+	if err := json.Unmarshal([]byte(data), m); err != nil {
+		log.WithFields(log.Fields{"data": data}).Error(err)
+		return nil, false
+	}
+	return m, true
+}
+
+func (m *syncMetadata) target() (*target, error) {
+	return newTarget(m.Label, m.Namespaces, m.NamespacePattern, m.Exclude)
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"testing"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/util/sets"
+)
+
+func TestParseSelector(t *testing.T) {
+	tests := []struct {
+		label   string
+		labels  map[string]string
+		want    bool
+		wantErr bool
+	}{
+		{"", nil, true, false},
+		{"env=prod", map[string]string{"env": "prod"}, true, false},
+		{"env=prod", map[string]string{"env": "dev"}, false, false},
+		{"env in (prod,staging),team!=legacy", map[string]string{"env": "staging", "team": "web"}, true, false},
+		{"env in (prod,staging),team!=legacy", map[string]string{"env": "staging", "team": "legacy"}, false, false},
+		{"!sandbox", map[string]string{"sandbox": "true"}, false, false},
+		{"!sandbox", nil, true, false},
+		{"env in (prod", nil, false, true},
+	}
+	for _, tt := range tests {
+		selector, err := parseSelector(tt.label)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("parseSelector(%q) error = %v, want error %v", tt.label, err, tt.wantErr)
+			continue
+		}
+		if err != nil {
+			continue
+		}
+		if got := selector.Matches(labels.Set(tt.labels)); got != tt.want {
+			t.Errorf("parseSelector(%q) matches %v = %v, want %v", tt.label, tt.labels, got, tt.want)
+		}
+	}
+}
+
+func TestNewTarget(t *testing.T) {
+	all := ""
+	prod := "env=prod"
+	invalid := "env in (prod"
+	tests := []struct {
+		name      string
+		label     *string
+		names     string
+		pattern   string
+		exclude   string
+		wantErr   bool
+		matches   []string
+		unmatched []string
+	}{
+		{name: "nothing targeted", unmatched: []string{"foo", "prod"}},
+		{name: "every namespace", label: &all, matches: []string{"foo", "prod", "sandbox"}},
+		{name: "label selector", label: &prod, matches: []string{"prod"}, unmatched: []string{"foo", "sandbox"}},
+		{name: "names", names: "foo, bar", matches: []string{"foo", "bar"}, unmatched: []string{"prod"}},
+		{name: "pattern", pattern: "^team-", matches: []string{"team-a"}, unmatched: []string{"foo", "a-team-"}},
+		{name: "any rule matches", label: &prod, names: "foo", pattern: "^team-", matches: []string{"prod", "foo", "team-a"}, unmatched: []string{"sandbox"}},
+		{name: "exclude wins", label: &all, names: "sandbox", exclude: "sandbox=true", matches: []string{"foo", "prod"}, unmatched: []string{"sandbox"}},
+		{name: "invalid label", label: &invalid, wantErr: true},
+		{name: "invalid pattern", pattern: "team-(", wantErr: true},
+		{name: "invalid exclude", exclude: "sandbox in (", wantErr: true},
+	}
+
+	namespaces := map[string]*v1.Namespace{
+		"foo":     namespace("foo", nil),
+		"bar":     namespace("bar", nil),
+		"prod":    namespace("prod", map[string]string{"env": "prod"}),
+		"sandbox": namespace("sandbox", map[string]string{"sandbox": "true"}),
+		"team-a":  namespace("team-a", nil),
+		"a-team-": namespace("a-team-", nil),
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			target, err := newTarget(tt.label, tt.names, tt.pattern, tt.exclude)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("newTarget() error = %v, want error %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			for _, name := range tt.matches {
+				if !target.matches(namespaces[name]) {
+					t.Errorf("namespace %s not matched", name)
+				}
+			}
+			for _, name := range tt.unmatched {
+				if target.matches(namespaces[name]) {
+					t.Errorf("namespace %s matched", name)
+				}
+			}
+		})
+	}
+}
+
+func namespace(name string, labels map[string]string) *v1.Namespace {
+	return &v1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: name, Labels: labels}}
+}
+
+func TestNamespaceExcluded(t *testing.T) {
+	selector, err := labels.Parse("tier=system")
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := &Controller{excludeNamespaces: sets.NewString("kube-system"), excludeNamespaceSelector: selector}
+	tests := []struct {
+		ns   *v1.Namespace
+		want bool
+	}{
+		{namespace("default", nil), false},
+		{namespace("kube-system", nil), true},
+		{namespace("monitoring", map[string]string{"tier": "system"}), true},
+		{namespace("team-a", map[string]string{ignoreLabel: "true"}), true},
+		{namespace("team-b", map[string]string{ignoreLabel: "false"}), false},
+	}
+	for _, tt := range tests {
+		if got := c.namespaceExcluded(tt.ns); got != tt.want {
+			t.Errorf("namespaceExcluded(%s) = %v, want %v", tt.ns.Name, got, tt.want)
+		}
+	}
+
+	everything := &target{selector: labels.Everything()}
+	if c.namespaceTargeted(everything, namespace("kube-system", nil)) {
+		t.Error("excluded namespace targeted")
+	}
+}
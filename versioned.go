@@ -0,0 +1,85 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+
+	log "github.com/sirupsen/logrus"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	// versionedAnnotation set to "true" on a source syncs it also as content addressed `<name>-<hash>` copies
+	versionedAnnotation string = syncAnnotation + "/versioned"
+	// retainVersionsAnnotation sets how many versioned copies are kept per namespace
+	retainVersionsAnnotation string = syncAnnotation + "/retain-versions"
+	// versionAnnotation holds the content hash on versioned copies
+	versionAnnotation string = syncAnnotation + "/version"
+	// currentVersionAnnotation on the stable alias copy points at the name of the current versioned copy
+	currentVersionAnnotation string = syncAnnotation + "/current-version"
+
+	defaultRetainVersions int = 3
+)
+
+func isVersioned(source metav1.Object) bool {
+	return source.GetAnnotations()[versionedAnnotation] == "true"
+}
+
+// retainVersions returns how many versioned copies of source are kept, the current one included
+func retainVersions(source metav1.Object) int {
+	v, ok := source.GetAnnotations()[retainVersionsAnnotation]
+	if !ok {
+		return defaultRetainVersions
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil || n < 1 {
+		log.WithFields(log.Fields{"namespace": source.GetNamespace(), "name": source.GetName(), "retain": v}).Warn("Retain versions not valid")
+		return defaultRetainVersions
+	}
+	return n
+}
+
+// contentHash returns short hash of the content, json encoding keeps map keys sorted so the hash is stable
+func contentHash(content interface{}) string {
+	b, _ := json.Marshal(content)
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:])[:10]
+}
+
+func versionedName(name, hash string) string {
+	return fmt.Sprintf("%s-%s", name, hash)
+}
+
+// expiredVersions returns the versioned copies of source that fall out of retention.
+// The current version is always kept and the rest are kept newest first until retain count is reached.
+// Without current version every versioned copy is expired.
+func expiredVersions(source metav1.Object, copies []metav1.Object, current string, retain int) []metav1.Object {
+	var versions []metav1.Object
+	for _, o := range copies {
+		if _, ok := o.GetAnnotations()[versionAnnotation]; !ok || o.GetName() == current {
+			continue
+		}
+		if m, ok := metadataFromAnnotations(o.GetAnnotations()); !ok || !m.isOrigin(source) {
+			continue
+		}
+		versions = append(versions, o)
+	}
+
+	sort.Slice(versions, func(i, j int) bool {
+		ti, tj := versions[i].GetCreationTimestamp(), versions[j].GetCreationTimestamp()
+		return tj.Before(&ti)
+	})
+
+	keep := 0
+	if current != "" {
+		keep = retain - 1
+	}
+	if len(versions) <= keep {
+		return nil
+	}
+	return versions[keep:]
+}
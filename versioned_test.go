@@ -0,0 +1,63 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestExpiredVersions(t *testing.T) {
+	source := &metav1.ObjectMeta{Namespace: "default", Name: "foo", UID: "1"}
+	other := &metav1.ObjectMeta{Namespace: "other", Name: "foo", UID: "2"}
+	now := time.Now()
+	version := func(name string, age time.Duration, origin metav1.Object) metav1.Object {
+		return &metav1.ObjectMeta{
+			Namespace:         "target",
+			Name:              name,
+			CreationTimestamp: metav1.NewTime(now.Add(-age)),
+			Annotations: map[string]string{
+				versionAnnotation:  name,
+				metadataAnnotation: newSyncMetadata(origin, "1", ""),
+			},
+		}
+	}
+	alias := &metav1.ObjectMeta{
+		Namespace:   "target",
+		Name:        "foo",
+		Annotations: map[string]string{metadataAnnotation: newSyncMetadata(source, "1", "")},
+	}
+	copies := []metav1.Object{
+		alias,
+		version("foo-a", 4*time.Hour, source),
+		version("foo-b", 3*time.Hour, source),
+		version("foo-c", 2*time.Hour, source),
+		version("foo-d", time.Hour, source),
+		version("foo-x", 5*time.Hour, other),
+	}
+
+	tests := []struct {
+		name    string
+		current string
+		retain  int
+		want    []string
+	}{
+		{"keeps retain count", "foo-d", 3, []string{"foo-a"}},
+		{"current counts towards retain", "foo-d", 1, []string{"foo-c", "foo-b", "foo-a"}},
+		{"current kept even if oldest", "foo-a", 2, []string{"foo-c", "foo-b"}},
+		{"nothing to expire", "foo-d", 10, nil},
+		{"all expired without current", "", 3, []string{"foo-d", "foo-c", "foo-b", "foo-a"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []string
+			for _, o := range expiredVersions(source, copies, tt.current, tt.retain) {
+				got = append(got, o.GetName())
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("expiredVersions(%q, %d) = %v, want %v", tt.current, tt.retain, got, tt.want)
+			}
+		})
+	}
+}